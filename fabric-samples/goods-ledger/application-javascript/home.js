@@ -122,6 +122,7 @@ main();
 const express = require('express');
 const router = express.Router();
 const bcrypt = require('bcryptjs');
+const crypto = require('crypto');
 const jwt = require('jsonwebtoken');
 
 //Home
@@ -131,30 +132,48 @@ router.get('/', (req, res) => {
     res.render(path.join(__dirname, 'views', 'home.ejs'));
 });
 
+// verifyPassword checks a password against the verifier returned by ReadAccountPasswordHash. Accounts written
+// before the chaincode hashed passwords still hold the bcrypt hash this application used to compute.
+async function verifyPassword(password, verifier) {
+    if(verifier.Algorithm === 'bcrypt'){
+        return bcrypt.compare(password, verifier.Hash);
+    }
+
+    const expectedHash = Buffer.from(verifier.Hash, 'hex');
+    const hash = crypto.pbkdf2Sync(password, Buffer.from(verifier.Salt, 'hex'), verifier.Iterations, expectedHash.length, 'sha256');
+
+    return crypto.timingSafeEqual(hash, expectedHash);
+}
+
 router.post('/loginAccount', async (req, res) => {
     const accountUsername = String(req.body.accountUsername);
 
-    const usernameResult = await contract.evaluateTransaction('QueryAccountbyUsername', accountUsername);
-    let usernameResultObject = usernameResult.toJSON().data;
+    const accountKeys = JSON.parse(await contract.evaluateTransaction('QueryAccountKeybyUsername', accountUsername));
 
-    if(usernameResultObject[0] == null){
+    if(accountKeys.length === 0){
         return res.send('Username doesn\'t exist');
     }
 
-    usernameResultObject = JSON.parse(usernameResult)[0];
-    console.log(usernameResultObject);
+    const accountKey = accountKeys[0];
+
+    // credentials are kept in the owning organization's private data, not in the public account document
+    const verifier = JSON.parse(await contract.evaluateTransaction('ReadAccountPasswordHash', accountKey));
 
-    const validPassword = await bcrypt.compare(String(req.body.accountPassword), usernameResultObject.AccountPassword);
+    const validPassword = await verifyPassword(String(req.body.accountPassword), verifier);
     if(!validPassword){
         return res.send('Invalid password.');
     }
 
     const secretKey = process.env.TOKEN_SECRET || "TOKEN_SECRET";
-    const accountToken = jwt.sign({_id: usernameResultObject.AccountToken}, secretKey);
+    const accountToken = jwt.sign({_id: accountKey}, secretKey);
 
-    await contract.submitTransaction('UpdateAccountToken', usernameResultObject.AccountToken, accountToken);
+    await contract.createTransaction('UpdateAccountToken')
+        .setTransient({ account_secret: Buffer.from(JSON.stringify({ AccountToken: accountToken })) })
+        .submit(accountKey, String(verifier.Version));
 
-    res.send(JSON.stringify(usernameResultObject));
+    const account = JSON.parse(await contract.evaluateTransaction('ReadAccount', accountKey));
+
+    res.send(JSON.stringify({ accountKey, accountToken, ...account }));
 });
 
 router.post('/registerAccount', async (req, res) => {
@@ -164,10 +183,7 @@ router.post('/registerAccount', async (req, res) => {
     const accountUsername = String(req.body.accountUsername);
     const accountEmail = String(req.body.accountEmail);
     const accountOwnerManufacturerID = String(req.body.accountOwnerManufacturerID);
-
-    const salt = await bcrypt.genSalt(10);
-    let hashedAccountPassword = await bcrypt.hash(req.body.accountPassword, salt);
-    const hashedConfirmedAccountPassword = await bcrypt.hash(req.body.accountConfirmedPassword, salt);
+    const accountPassword = String(req.body.accountPassword);
 
     const usernameResult = await contract.evaluateTransaction('QueryAccountbyUsername', accountUsername);
     const usernameResultObject = usernameResult.toJSON().data;
@@ -183,25 +199,25 @@ router.post('/registerAccount', async (req, res) => {
          return res.send('Email already exist.');
     }
 
-    if(hashedAccountPassword !== hashedConfirmedAccountPassword){
+    if(accountPassword !== String(req.body.accountConfirmedPassword)){
         return res.send('Password didn\'t match.');
     }
 
-    const accountKeyValue = accountType + accountEmail + accountUsername;
-    const newSalt = await bcrypt.genSalt(10);
-    let accountKey = await bcrypt.hash(accountKeyValue, newSalt);
     const docType = "account";
 
     const secretKey = process.env.TOKEN_SECRET || "TOKEN_SECRET";
-    let accountToken = jwt.sign({_id: accountKey}, secretKey);
-
-    accountKey = String(accountKey);
-    accountToken = String(accountToken);
-    hashedAccountPassword = String(hashedAccountPassword);
-
-    await contract.submitTransaction('RegisterAccount', accountKey, accountToken, accountType, accountName, accountUsername, accountEmail, hashedAccountPassword, accountOwnerManufacturerID, docType);
-
-    res.send(JSON.stringify({ accountKey, accountToken, accountType, accountName, accountUsername, accountEmail, hashedAccountPassword, accountOwnerManufacturerID, docType }));
+    const accountToken = String(jwt.sign({_id: accountUsername}, secretKey));
+
+    // credentials and personal details travel in the transient map so they are never written to the ledger;
+    // the chaincode stores only a salted hash of the password
+    const accountKey = String(await contract.createTransaction('RegisterAccount')
+        .setTransient({
+            account_secret: Buffer.from(JSON.stringify({ AccountPassword: accountPassword, AccountToken: accountToken })),
+            account_details: Buffer.from(JSON.stringify({ AccountName: accountName, AccountEmail: accountEmail }))
+        })
+        .submit(accountType, accountUsername, accountOwnerManufacturerID, docType));
+
+    res.send(JSON.stringify({ accountKey, accountToken, accountType, accountName, accountUsername, accountEmail, accountOwnerManufacturerID, docType }));
 });
 
 router.post('/addManufacturer', async (req, res) => {
@@ -219,16 +235,13 @@ router.post('/addManufacturer', async (req, res) => {
          return res.send('This Trade Licence belongs to someone else.');
     }
 
-    const manufacturerKeyValue = manufacturerAccountID + manufacturerName + manufacturerTradeLicenceID;
-    const salt = await bcrypt.genSalt(10);
-    const manufacturerKey = await bcrypt.hash(manufacturerKeyValue, salt);
+    const manufacturerKey = String(await contract.submitTransaction('AddManufacturer', manufacturerAccountID, manufacturerName, manufacturerTradeLicenceID, manufacturerLocation, manufacturerFoundingDate, docType));
 
     const accountKey = manufacturerAccountID;
     const accountOwnerManufacturerID = manufacturerKey;
+    const account = JSON.parse(await contract.evaluateTransaction('ReadAccount', accountKey));
 
-    await contract.submitTransaction('UpdateAccountOwnerManufacturerID', accountKey, accountOwnerManufacturerID);
-
-    await contract.submitTransaction('AddManufacturer', manufacturerKey, manufacturerAccountID, manufacturerName, manufacturerTradeLicenceID, manufacturerLocation, manufacturerFoundingDate, docType);
+    await contract.submitTransaction('UpdateAccountOwnerManufacturerID', accountKey, accountOwnerManufacturerID, String(account.Version));
 
     res.send(JSON.stringify({ manufacturerKey, manufacturerAccountID, manufacturerName, manufacturerTradeLicenceID, manufacturerLocation, manufacturerFoundingDate, docType }));
 });
@@ -240,11 +253,7 @@ router.post('/addFactory', async (req, res) => {
     const factoryLocation = String(req.body.factoryLocation);
     const docType = "factory";
 
-    const factoryKeyValue = factoryManufacturerID + factoryID + factoryName;
-    const salt = await bcrypt.genSalt(10);
-    const factoryKey = await bcrypt.hash(factoryKeyValue, salt);
-
-    await contract.submitTransaction('AddFactory', factoryKey, factoryManufacturerID, factoryID, factoryName, factoryLocation, docType);
+    const factoryKey = String(await contract.submitTransaction('AddFactory', factoryManufacturerID, factoryID, factoryName, factoryLocation, docType));
 
     res.send(JSON.stringify({ factoryKey, factoryManufacturerID, factoryID, factoryName, factoryLocation, docType }));
 });
@@ -264,11 +273,7 @@ router.post('/addProduct', async (req, res) => {
     const productExpiryDate = String(req.body.productExpiryDate);
     const docType = "product"
 
-    const productKeyValue = productManufacturerID + productFactoryID + productBatch + productID + productSerialinBatch;
-    const salt = await bcrypt.genSalt(10);
-    const productKey = await bcrypt.hash(productKeyValue, salt);
-
-    await contract.submitTransaction('AddProduct', productKey, productOwnerAccountID, productManufacturerID, productManufacturerName, productFactoryID, productID, productName, productType, productBatch, productSerialinBatch, productManufacturingLocation, productManufacturingDate, productExpiryDate, docType);
+    const productKey = String(await contract.submitTransaction('AddProduct', productOwnerAccountID, productManufacturerID, productManufacturerName, productFactoryID, productID, productName, productType, productBatch, productSerialinBatch, productManufacturingLocation, productManufacturingDate, productExpiryDate, docType));
 
     res.send(JSON.stringify({ productKey, productOwnerAccountID, productManufacturerID, productManufacturerName, productFactoryID, productID, productName, productType, productBatch, productSerialinBatch, productManufacturingLocation, productManufacturingDate, productExpiryDate, docType }));
 });
@@ -276,8 +281,10 @@ router.post('/addProduct', async (req, res) => {
 router.post('/updateProductOwner', async (req, res) => {
     const productOwnerAccountID = String(req.body.productOwnerAccountID);
     const productKey = String(req.body.productKey);
+    // updates are rejected unless the document is still at the version they were read at
+    const product = JSON.parse(await contract.evaluateTransaction('ReadProduct', productKey));
 
-    await contract.submitTransaction('UpdateProductOwner', productKey, productOwnerAccountID);
+    await contract.submitTransaction('UpdateProductOwner', productKey, productOwnerAccountID, String(product.Version));
 
     res.send(JSON.stringify({ productKey, productOwnerAccountID }));
 });
@@ -285,15 +292,18 @@ router.post('/updateProductOwner', async (req, res) => {
 router.post('/updateAccountToken', async (req, res) => {
     const accountKey = String(req.body.accountKey);
     const accountToken = String(req.body.accountToken);
+    const verifier = JSON.parse(await contract.evaluateTransaction('ReadAccountPasswordHash', accountKey));
 
-    await contract.submitTransaction('UpdateAccountToken', accountKey, accountToken);
+    // the token travels in the transient map so it never appears in the transaction arguments
+    await contract.createTransaction('UpdateAccountToken')
+        .setTransient({ account_secret: Buffer.from(JSON.stringify({ AccountToken: accountToken })) })
+        .submit(accountKey, String(verifier.Version));
 
     res.send(JSON.stringify({ accountKey, accountToken }));
 });
 
 router.post('/updateAccount', async (req, res) => {
     const accountKey = String(req.body.accountKey);
-    const accountToken = String(req.body.accountToken);
     const accountName = String(req.body.accountName);
     const accountEmail = String(req.body.accountEmail);
     const accountPhoneNumber = String(req.body.accountPhoneNumber);
@@ -305,9 +315,16 @@ router.post('/updateAccount', async (req, res) => {
          return res.send('Email already exist.');
     }
 
-    await contract.submitTransaction('UpdateAccount', accountKey, accountToken, accountName, accountEmail, accountPhoneNumber);
+    const details = JSON.parse(await contract.evaluateTransaction('ReadAccountDetails', accountKey));
+
+    // personal details are kept in the owning organization's private data, so they travel in the transient map
+    await contract.createTransaction('UpdateAccount')
+        .setTransient({
+            account_details: Buffer.from(JSON.stringify({ AccountName: accountName, AccountEmail: accountEmail, AccountPhoneNumber: accountPhoneNumber }))
+        })
+        .submit(accountKey, String(details.Version));
 
-    res.send(JSON.stringify({ accountKey, accountToken, accountName, accountEmail, accountPhoneNumber }));
+    res.send(JSON.stringify({ accountKey, accountName, accountEmail, accountPhoneNumber }));
 });
 
 router.post('/updateManufacturer', async (req, res) => {
@@ -316,8 +333,9 @@ router.post('/updateManufacturer', async (req, res) => {
     const manufacturerTradeLicenceID = String(req.body.manufacturerTradeLicenceID);
     const manufacturerLocation = String(req.body.manufacturerLocation);
     const manufacturerFoundingDate = String(req.body.manufacturerFoundingDate);
+    const manufacturer = JSON.parse(await contract.evaluateTransaction('ReadManufacturer', manufacturerKey));
 
-    await contract.submitTransaction('UpdateManufacturer', manufacturerKey, manufacturerName, manufacturerTradeLicenceID, manufacturerLocation, manufacturerFoundingDate);
+    await contract.submitTransaction('UpdateManufacturer', manufacturerKey, manufacturerName, manufacturerTradeLicenceID, manufacturerLocation, manufacturerFoundingDate, String(manufacturer.Version));
 
     res.send(JSON.stringify({ manufacturerKey, manufacturerName, manufacturerTradeLicenceID, manufacturerLocation, manufacturerFoundingDate }));
 });
@@ -327,8 +345,9 @@ router.post('/updateFactory', async (req, res) => {
     const factoryManufacturerID = String(req.body.factoryManufacturerID);
     const factoryName = String(req.body.factoryName);
     const factoryLocation = String(req.body.factoryLocation);
+    const factory = JSON.parse(await contract.evaluateTransaction('ReadFactory', factoryKey));
 
-    await contract.submitTransaction('UpdateFactory', factoryKey, factoryManufacturerID, factoryName, factoryLocation);
+    await contract.submitTransaction('UpdateFactory', factoryKey, factoryManufacturerID, factoryName, factoryLocation, String(factory.Version));
 
     res.send(JSON.stringify({ factoryKey, factoryManufacturerID, factoryName, factoryLocation }));
 });
@@ -344,8 +363,9 @@ router.post('/updateProduct', async (req, res) => {
     const productManufacturingLocation = String(req.body.productManufacturingLocation);
     const productManufacturingDate = String(req.body.productManufacturingDate);
     const productExpiryDate = String(req.body.productExpiryDate);
+    const product = JSON.parse(await contract.evaluateTransaction('ReadProduct', productKey));
 
-    await contract.submitTransaction('UpdateProduct', productKey, productOwnerAccountID, productFactoryID, productName, productType, productBatch, productSerialinBatch, productManufacturingLocation, productManufacturingDate, productExpiryDate);
+    await contract.submitTransaction('UpdateProduct', productKey, productOwnerAccountID, productFactoryID, productName, productType, productBatch, productSerialinBatch, productManufacturingLocation, productManufacturingDate, productExpiryDate, String(product.Version));
 
     res.send(JSON.stringify({ productKey, productOwnerAccountID, productFactoryID, productName, productType, productBatch, productSerialinBatch, productManufacturingLocation, productManufacturingDate, productExpiryDate }));
 });
@@ -0,0 +1,99 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// submitter identifies the X.509 identity that submitted the current transaction
+type submitter struct {
+	mspID    string
+	clientID string
+}
+
+// getSubmitter returns the MSP ID and certificate ID of the submitting client
+func getSubmitter(ctx contractapi.TransactionContextInterface) (*submitter, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to get submitter MSP ID: %v", err)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to get submitter client ID: %v", err)
+	}
+
+	return &submitter{mspID: mspID, clientID: clientID}, nil
+}
+
+// ownsAccount returns true when the account is bound to the submitter's identity
+func (caller *submitter) ownsAccount(account *Account) bool {
+	return account.AccountMSPID != "" &&
+		account.AccountMSPID == caller.mspID &&
+		account.AccountClientID == caller.clientID
+}
+
+// requireAccountOwner reads the account with given key and fails unless it is bound to the submitter
+func requireAccountOwner(ctx contractapi.TransactionContextInterface, accountKey string) (*Account, error) {
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := readAccount(ctx, accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if !caller.ownsAccount(account) {
+		return nil, ledgerErrorf(ErrUnauthorized, "the submitting identity does not own account %s", accountKey)
+	}
+
+	return account, nil
+}
+
+// rephraseUnauthorized describes an ownership failure in the terms of the transaction that checked it.
+// Any other error, such as a missing account or a failed read, is returned unchanged.
+func rephraseUnauthorized(err error, format string, args ...interface{}) error {
+	if ErrorCodeOf(err) != ErrUnauthorized {
+		return err
+	}
+
+	return ledgerErrorf(ErrUnauthorized, format, args...)
+}
+
+// requireManufacturerOwner reads the manufacturer with given key and fails unless the submitter owns its account
+func requireManufacturerOwner(ctx contractapi.TransactionContextInterface, manufacturerKey string) (*Manufacturer, error) {
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manufacturer, err := readManufacturer(ctx, manufacturerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := readAccount(ctx, manufacturer.ManufacturerAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !caller.ownsAccount(account) {
+		return nil, ledgerErrorf(ErrUnauthorized, "the submitting identity does not own manufacturer %s", manufacturerKey)
+	}
+
+	return manufacturer, nil
+}
+
+// adminAttribute is the certificate attribute that marks goods-ledger administrators
+const adminAttribute = "goodsledger.admin"
+
+// requireAdmin fails unless the submitter's certificate carries goodsledger.admin=true
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	err := ctx.GetClientIdentity().AssertAttributeValue(adminAttribute, "true")
+	if err != nil {
+		return ledgerErrorf(ErrUnauthorized, "the submitting identity is not a goods-ledger administrator: %v", err)
+	}
+
+	return nil
+}
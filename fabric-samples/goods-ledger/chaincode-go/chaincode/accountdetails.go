@@ -0,0 +1,136 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// accountDetailsTransientKey is the transient map entry carrying AccountDetails
+const accountDetailsTransientKey = "account_details"
+
+// accountEmailIndex maps email hashes to account keys inside the private data collection
+const accountEmailIndex = "accountDetails~email"
+
+// AccountDetails holds the personal details of an account.
+// It is only stored in the implicit private data collection of the organization owning the account.
+type AccountDetails struct {
+	AccountName        string `json:"AccountName"`
+	AccountEmail       string `json:"AccountEmail"`
+	AccountPhoneNumber string `json:"AccountPhoneNumber"`
+	Version            int    `json:"Version"`
+	DocType            string `json:"DocType"`
+}
+
+// hashAccountEmail returns the lookup hash of an email address, ignoring case and surrounding spaces
+func hashAccountEmail(accountEmail string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(accountEmail))))
+	return hex.EncodeToString(hash[:])
+}
+
+// accountDetailsKey returns the private data key of the details belonging to the given account
+func accountDetailsKey(ctx contractapi.TransactionContextInterface, accountKey string) (string, error) {
+	return createCompositeKey(ctx, "accountDetails", []string{keyAttribute(accountKey)})
+}
+
+// getAccountDetailsInput reads the account's personal details from the transient map
+func getAccountDetailsInput(ctx contractapi.TransactionContextInterface) (*AccountDetails, error) {
+	var input AccountDetails
+	err := getTransientInput(ctx, accountDetailsTransientKey, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &input, nil
+}
+
+// readAccountDetails returns the details of the given account from the collection, or nil when none are stored
+func readAccountDetails(ctx contractapi.TransactionContextInterface, collection string, accountKey string) (*AccountDetails, error) {
+	detailsKey, err := accountDetailsKey(ctx, accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	detailsAsBytes, err := ctx.GetStub().GetPrivateData(collection, detailsKey)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to read from private data collection %s: %v", collection, err)
+	}
+	if detailsAsBytes == nil {
+		return nil, nil
+	}
+
+	var details AccountDetails
+	err = json.Unmarshal(detailsAsBytes, &details)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "the account details of %s are corrupt: %v", accountKey, err)
+	}
+
+	return &details, nil
+}
+
+// putAccountDetails stores the account's personal details and keeps the email lookup index current
+func putAccountDetails(ctx contractapi.TransactionContextInterface, collection string, accountKey string, details *AccountDetails) error {
+	previous, err := readAccountDetails(ctx, collection, accountKey)
+	if err != nil {
+		return err
+	}
+
+	previousEmailHash := ""
+	details.Version = 1
+	if previous != nil {
+		if previous.AccountEmail != "" {
+			previousEmailHash = hashAccountEmail(previous.AccountEmail)
+		}
+		details.Version = previous.Version + 1
+	}
+
+	emailHash := ""
+	if details.AccountEmail != "" {
+		emailHash = hashAccountEmail(details.AccountEmail)
+	}
+
+	err = putPrivateIndex(ctx, collection, accountEmailIndex, previousEmailHash, emailHash, accountKey)
+	if err != nil {
+		return err
+	}
+
+	details.DocType = "accountDetails"
+	detailsAsBytes, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	detailsKey, err := accountDetailsKey(ctx, accountKey)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutPrivateData(collection, detailsKey, detailsAsBytes)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to write to private data collection %s: %v", collection, err)
+	}
+
+	return nil
+}
+
+// ReadAccountDetails returns the personal details of an account owned by the submitter.
+// The details are only readable on peers of the organization that owns the account.
+func (s *SmartContract) ReadAccountDetails(ctx contractapi.TransactionContextInterface, accountKey string) (*AccountDetails, error) {
+	account, err := requireAccountOwner(ctx, accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := readAccountDetails(ctx, implicitCollection(account.AccountMSPID), accountKey)
+	if err != nil {
+		return nil, err
+	}
+	if details == nil {
+		return nil, ledgerErrorf(ErrNotFound, "the account %s has no stored details", accountKey)
+	}
+
+	return details, nil
+}
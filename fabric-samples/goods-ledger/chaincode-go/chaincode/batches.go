@@ -0,0 +1,209 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxBatchQuantity caps how many products MintBatch writes in one transaction. Each product is a document plus
+// its index entries; with every field at its maximum length a full batch writes about 1 MiB (see TestMintBatchAtCap),
+// far below the orderer's default 99 MiB AbsoluteMaxBytes and the peers' 100 MiB gRPC message limit.
+const maxBatchQuantity = 500
+
+// Batch is one production run of a factory. Its products share the batch ID and are numbered 1 to BatchQuantity.
+type Batch struct {
+	BatchManufacturerID  string `json:"BatchManufacturerID"`
+	BatchFactoryID       string `json:"BatchFactoryID"`
+	BatchID              string `json:"BatchID"`
+	BatchProductionStart string `json:"BatchProductionStart"`
+	BatchProductionEnd   string `json:"BatchProductionEnd"`
+	BatchQuantity        int    `json:"BatchQuantity"`
+	BatchExpiryDate      string `json:"BatchExpiryDate"`
+	SchemaVersion        int    `json:"SchemaVersion"`
+	Version              int    `json:"Version"`
+	DocType              string `json:"DocType"`
+}
+
+// MintBatch records a production run and creates its products in one transaction. The products are owned by the
+// manufacturer's account and get serials 1 to quantity, zero-padded so they sort in order. It returns the batch key.
+func (s *SmartContract) MintBatch(ctx contractapi.TransactionContextInterface,
+	manufacturerID string, factoryID string, batchID string, productID string, productName string, productType string,
+	productManufacturingLocation string, productionStart string, productionEnd string, expiryDate string, quantity int) (string, error) {
+
+	err := validationError(
+		batchValidations.check(&Batch{
+			BatchID:              batchID,
+			BatchProductionStart: productionStart,
+			BatchProductionEnd:   productionEnd,
+			BatchExpiryDate:      expiryDate,
+		}),
+		productValidations.only("ProductID", "ProductName", "ProductType", "ProductManufacturingLocation").check(&Product{
+			ProductID:                    productID,
+			ProductName:                  productName,
+			ProductType:                  productType,
+			ProductManufacturingLocation: productManufacturingLocation,
+		}),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	manufacturer, err := requireManufacturerOwner(ctx, manufacturerID)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireFactoryOfManufacturer(ctx, factoryID, manufacturerID)
+	if err != nil {
+		return "", err
+	}
+
+	if quantity < 1 || quantity > maxBatchQuantity {
+		return "", ledgerErrorf(ErrValidationFailed, "the batch quantity must be between 1 and %d", maxBatchQuantity)
+	}
+
+	productionStart, _, err = normalizeLedgerDate(productionStart)
+	if err != nil {
+		return "", err
+	}
+	productionEnd, expiryDate, err = validateProductDates(ctx, productionEnd, expiryDate)
+	if err != nil {
+		return "", err
+	}
+	// normalized dates sort chronologically
+	if productionEnd < productionStart {
+		return "", ledgerErrorf(ErrValidationFailed, "the production window of batch %s ends before it starts", batchID)
+	}
+
+	batchKey, err := newBatchKey(ctx, manufacturerID, batchID)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireAbsent(ctx, batchObjectType, batchKey)
+	if err != nil {
+		return "", err
+	}
+
+	batch := Batch{
+		BatchManufacturerID:  manufacturerID,
+		BatchFactoryID:       factoryID,
+		BatchID:              batchID,
+		BatchProductionStart: productionStart,
+		BatchProductionEnd:   productionEnd,
+		BatchQuantity:        quantity,
+		BatchExpiryDate:      expiryDate,
+		SchemaVersion:        currentSchemaVersion(batchObjectType),
+		Version:              1,
+		DocType:              batchObjectType,
+	}
+	batchAsBytes, err := json.Marshal(batch)
+	if err != nil {
+		return "", err
+	}
+
+	err = putDocument(ctx, batchKey, batchAsBytes)
+	if err != nil {
+		return "", err
+	}
+
+	width := len(strconv.Itoa(quantity))
+	productKeys := make([]string, 0, quantity)
+	for serial := 1; serial <= quantity; serial++ {
+		serialInBatch := fmt.Sprintf("%0*d", width, serial)
+		productKey, err := newProductKey(ctx, manufacturerID, batchID, serialInBatch)
+		if err != nil {
+			return "", err
+		}
+
+		// products added one by one under the same batch ID must not be overwritten
+		err = requireAbsent(ctx, productObjectType, productKey)
+		if err != nil {
+			return "", err
+		}
+
+		product := Product{
+			ProductOwnerAccountID:        manufacturer.ManufacturerAccountID,
+			ProductManufacturerID:        manufacturerID,
+			ProductManufacturerName:      manufacturer.ManufacturerName,
+			ProductFactoryID:             factoryID,
+			ProductID:                    productID,
+			ProductName:                  productName,
+			ProductType:                  productType,
+			ProductBatch:                 batchID,
+			ProductSerialinBatch:         serialInBatch,
+			ProductManufacturingLocation: productManufacturingLocation,
+			ProductManufacturingDate:     productionEnd,
+			ProductExpiryDate:            expiryDate,
+			DocType:                      productObjectType,
+		}
+		err = putProduct(ctx, productKey, &product)
+		if err != nil {
+			return "", err
+		}
+		productKeys = append(productKeys, productKey)
+	}
+
+	return batchKey, emitEvent(ctx, EventBatchMinted, &LedgerEvent{
+		Key:               batchKey,
+		Keys:              productKeys,
+		DocType:           batchObjectType,
+		ManufacturerID:    manufacturerID,
+		FactoryID:         factoryID,
+		NewOwnerAccountID: manufacturer.ManufacturerAccountID,
+	})
+}
+
+// ReadBatch returns the batch stored in the world state with given key
+func (s *SmartContract) ReadBatch(ctx contractapi.TransactionContextInterface, batchKey string) (*Batch, error) {
+	var batch Batch
+	exists, err := readDocument(ctx, batchKey, &batch)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || batch.DocType != batchObjectType {
+		return nil, ledgerErrorf(ErrNotFound, "the batch %s does not exist", batchKey)
+	}
+
+	return &batch, nil
+}
+
+// QueryBatchbyManufacturerID returns the batches produced by the manufacturer
+func (s *SmartContract) QueryBatchbyManufacturerID(ctx contractapi.TransactionContextInterface,
+	batchManufacturerID string) ([]*Batch, error) {
+
+	return getBatchQueryResultForIndex(ctx, batchByManufacturerIndex, batchManufacturerID)
+}
+
+// QueryBatchbyManufacturerIDWithPagination returns one page of the results of QueryBatchbyManufacturerID.
+func (s *SmartContract) QueryBatchbyManufacturerIDWithPagination(ctx contractapi.TransactionContextInterface,
+	batchManufacturerID string, pageSize int32, bookmark string) (*PaginatedBatchQueryResult, error) {
+
+	return getBatchQueryResultForIndexWithPagination(ctx, pageSize, bookmark, batchByManufacturerIndex, batchManufacturerID)
+}
+
+func constructBatchQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Batch, error) {
+	var batches []*Batch
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(batches) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d batches, use its paginated variant", maxUnpagedQueryResults)
+		}
+
+		var batch Batch
+		err = json.Unmarshal(queryResult.Value, &batch)
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
+		}
+		batches = append(batches, &batch)
+	}
+
+	return batches, nil
+}
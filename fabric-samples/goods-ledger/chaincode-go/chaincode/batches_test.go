@@ -0,0 +1,94 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMintBatch(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+	}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		worldState[key] = value
+		return nil
+	}
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.MintBatch(transactionContext, "manufacturer1", "factory1", "B1", "sku", "Soap", "cosmetics",
+		"Dhaka", "2020-09-02", "2020-09-01", "2022-09-01", 12)
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	_, err = goodsLedger.MintBatch(transactionContext, "manufacturer1", "factory1", "B1", "sku", "Soap", "cosmetics",
+		"Dhaka", "2020-09-01", "2020-09-02", "2022-09-01", 0)
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	batchKey, err := goodsLedger.MintBatch(transactionContext, "manufacturer1", "factory1", "B1", "sku", "Soap", "cosmetics",
+		"Dhaka", "2020-09-01", "2020-09-02", "2022-09-01", 12)
+	require.NoError(t, err)
+	require.Equal(t, "\x00batch\x00manufacturer1\x00B1\x00", batchKey)
+
+	var batch chaincode.Batch
+	require.NoError(t, json.Unmarshal(worldState[batchKey], &batch))
+	require.Equal(t, 12, batch.BatchQuantity)
+	require.Equal(t, "batch", batch.DocType)
+
+	productKey := "\x00product\x00manufacturer1\x00B1\x0012\x00"
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(worldState[productKey], &product))
+	require.Equal(t, "account1", product.ProductOwnerAccountID)
+	require.Equal(t, "Acme", product.ProductManufacturerName)
+	require.Equal(t, "12", product.ProductSerialinBatch)
+	require.Contains(t, worldState, "\x00product\x00manufacturer1\x00B1\x0001\x00")
+
+	eventName, payload := chaincodeStub.SetEventArgsForCall(0)
+	require.Equal(t, chaincode.EventBatchMinted, eventName)
+	var minted chaincode.LedgerEvent
+	require.NoError(t, json.Unmarshal(payload, &minted))
+	require.Equal(t, batchKey, minted.Key)
+	require.Len(t, minted.Keys, 12)
+	require.Equal(t, "\x00product\x00manufacturer1\x00B1\x0001\x00", minted.Keys[0])
+	require.Equal(t, productKey, minted.Keys[11])
+
+	products, err := goodsLedger.QueryProductbyManufacturerID(transactionContext, "manufacturer1")
+	require.NoError(t, err)
+	require.Len(t, products, 12)
+
+	_, err = goodsLedger.MintBatch(transactionContext, "manufacturer1", "factory1", "B1", "sku", "Soap", "cosmetics",
+		"Dhaka", "2020-09-01", "2020-09-02", "2022-09-01", 12)
+	requireErrorCode(t, err, chaincode.ErrAlreadyExists)
+}
+
+func TestMintBatchAtCap(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+	}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	writtenBytes := 0
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		writtenBytes += len(key) + len(value)
+		return nil
+	}
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.MintBatch(transactionContext, "manufacturer1", "factory1", "B1", "sku", "Soap", "cosmetics",
+		"Dhaka", "2020-09-01", "2020-09-02", "2022-09-01", 501)
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	// a full batch with every field at its maximum length
+	_, err = goodsLedger.MintBatch(transactionContext, "manufacturer1", "factory1", strings.Repeat("b", 64), strings.Repeat("s", 64),
+		strings.Repeat("n", 128), "electronics", strings.Repeat("l", 256), "2020-09-01", "2020-09-02", "2022-09-01", 500)
+	require.NoError(t, err)
+	// the batch and its index entry, then each product and its five index entries
+	require.Equal(t, 2+500*6, chaincodeStub.PutStateCallCount())
+	require.Less(t, writtenBytes, 1536<<10)
+}
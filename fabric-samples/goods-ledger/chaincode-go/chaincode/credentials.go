@@ -0,0 +1,527 @@
+package chaincode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// accountSecretTransientKey is the transient map entry carrying AccountSecretInput
+const accountSecretTransientKey = "account_secret"
+
+// accountTokenIndex maps token hashes to account keys inside the private data collection
+const accountTokenIndex = "accountSecret~token"
+
+// AccountSecretInput is passed through the transient map so credentials never appear in transaction arguments
+type AccountSecretInput struct {
+	AccountPassword string `json:"AccountPassword"`
+	AccountToken    string `json:"AccountToken"`
+}
+
+// Passwords are stored as PBKDF2-HMAC-SHA256 verifiers. Endorsing peers must compute the same verifier, so the
+// salt is derived from the transaction ID and the account key instead of being random; it is stored with the
+// verifier together with the iteration count, which lets the count be raised without invalidating old verifiers.
+const (
+	passwordHashAlgorithm  = "pbkdf2-sha256"
+	passwordHashIterations = 100000
+	passwordHashLength     = sha256.Size
+	passwordSaltLength     = 16
+)
+
+// AccountSecret holds the credential verifiers of an account.
+// It is only stored in the implicit private data collection of the organization owning the account.
+type AccountSecret struct {
+	AccountPasswordHash       string `json:"AccountPasswordHash"`
+	AccountPasswordSalt       string `json:"AccountPasswordSalt"`
+	AccountPasswordIterations int    `json:"AccountPasswordIterations"`
+	AccountTokenHash          string `json:"AccountTokenHash"`
+	Version                   int    `json:"Version"`
+	DocType                   string `json:"DocType"`
+}
+
+// PasswordVerifier is everything a client needs to check a password against the stored verifier:
+// Hash must equal the hex encoded PBKDF2 of the password with the hex decoded Salt and Iterations.
+// Version is the version of the stored credentials that UpdateAccountToken expects.
+type PasswordVerifier struct {
+	Algorithm  string `json:"Algorithm"`
+	Iterations int    `json:"Iterations"`
+	Salt       string `json:"Salt"`
+	Hash       string `json:"Hash"`
+	Version    int    `json:"Version"`
+}
+
+// legacyAccount picks the credentials and personal details out of accounts written before they were
+// moved off the ledger
+type legacyAccount struct {
+	AccountPassword    *string `json:"AccountPassword"`
+	AccountToken       *string `json:"AccountToken"`
+	AccountName        *string `json:"AccountName"`
+	AccountEmail       *string `json:"AccountEmail"`
+	AccountPhoneNumber *string `json:"AccountPhoneNumber"`
+}
+
+// implicitCollection returns the name of the implicit private data collection of the given organization
+func implicitCollection(mspID string) string {
+	return "_implicit_org_" + mspID
+}
+
+// hashAccountToken returns the verifier stored for a session token. It doubles as the key of the token lookup
+// index and therefore cannot be salted; only high-entropy tokens are accepted instead, see minTokenLength.
+func hashAccountToken(accountToken string) string {
+	hash := sha256.Sum256([]byte(accountToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// newPasswordSalt derives the salt of a password set by the current transaction for the given account
+func newPasswordSalt(ctx contractapi.TransactionContextInterface, accountKey string) []byte {
+	hash := sha256.Sum256([]byte("accountSecret\x00" + ctx.GetStub().GetTxID() + "\x00" + accountKey))
+	return hash[:passwordSaltLength]
+}
+
+// hashPassword derives the PBKDF2-HMAC-SHA256 verifier of a password (RFC 8018)
+func hashPassword(password string, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, []byte(password))
+	derived := make([]byte, 0, passwordHashLength)
+	for block := uint32(1); len(derived) < passwordHashLength; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var blockIndex [4]byte
+		binary.BigEndian.PutUint32(blockIndex[:], block)
+		prf.Write(blockIndex[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		derived = append(derived, t...)
+	}
+
+	return derived[:passwordHashLength]
+}
+
+// accountSecretKey returns the private data key of the secret belonging to the given account
+func accountSecretKey(ctx contractapi.TransactionContextInterface, accountKey string) (string, error) {
+	return createCompositeKey(ctx, "accountSecret", []string{keyAttribute(accountKey)})
+}
+
+// getTransientInput unmarshals the transient map entry with given key into input
+func getTransientInput(ctx contractapi.TransactionContextInterface, transientKey string, input interface{}) error {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to read transient map: %v", err)
+	}
+
+	inputJSON, ok := transientMap[transientKey]
+	if !ok {
+		return ledgerErrorf(ErrValidationFailed, "the input must be passed in the transient map under %s", transientKey)
+	}
+
+	err = json.Unmarshal(inputJSON, input)
+	if err != nil {
+		return ledgerErrorf(ErrValidationFailed, "failed to unmarshal transient input %s: %v", transientKey, err)
+	}
+
+	return nil
+}
+
+// getAccountSecretInput reads the account credentials from the transient map
+func getAccountSecretInput(ctx contractapi.TransactionContextInterface) (*AccountSecretInput, error) {
+	var input AccountSecretInput
+	err := getTransientInput(ctx, accountSecretTransientKey, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &input, nil
+}
+
+// queryAccountByPrivateIndex returns the account referenced by a hashed lookup entry in the submitting
+// organization's private data collection
+func queryAccountByPrivateIndex(ctx contractapi.TransactionContextInterface, index string, hash string) ([]*Account, error) {
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	indexKey, err := createCompositeKey(ctx, index, []string{hash})
+	if err != nil {
+		return nil, err
+	}
+
+	accountKey, err := ctx.GetStub().GetPrivateData(implicitCollection(caller.mspID), indexKey)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to read from private data collection: %v", err)
+	}
+	if accountKey == nil {
+		return nil, nil
+	}
+
+	account, err := readAccount(ctx, string(accountKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Account{account}, nil
+}
+
+// putPrivateIndex points the hashed lookup entry at the account, removing the entry for the previous hash.
+// An empty hash only removes the previous entry. It fails with CONFLICT when the entry belongs to another
+// account, so an email or token can never be taken over from the account that registered it.
+func putPrivateIndex(ctx contractapi.TransactionContextInterface, collection string, index string,
+	previousHash string, hash string, accountKey string) error {
+
+	var indexKey string
+	if hash != "" {
+		var err error
+		indexKey, err = createCompositeKey(ctx, index, []string{hash})
+		if err != nil {
+			return err
+		}
+
+		indexedKey, err := ctx.GetStub().GetPrivateData(collection, indexKey)
+		if err != nil {
+			return ledgerErrorf(ErrInternal, "failed to read from private data collection %s: %v", collection, err)
+		}
+		if indexedKey != nil && string(indexedKey) != accountKey {
+			return ledgerErrorf(ErrConflict, "the %s lookup entry belongs to another account", index)
+		}
+	}
+
+	if previousHash != "" && previousHash != hash {
+		previousKey, err := createCompositeKey(ctx, index, []string{previousHash})
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().DelPrivateData(collection, previousKey)
+		if err != nil {
+			return ledgerErrorf(ErrInternal, "failed to delete from private data collection %s: %v", collection, err)
+		}
+	}
+
+	if hash == "" {
+		return nil
+	}
+
+	err := ctx.GetStub().PutPrivateData(collection, indexKey, []byte(accountKey))
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to write to private data collection %s: %v", collection, err)
+	}
+
+	return nil
+}
+
+// readAccountSecret returns the secret of the given account from the collection, or nil when none is stored
+func readAccountSecret(ctx contractapi.TransactionContextInterface, collection string, accountKey string) (*AccountSecret, error) {
+	secretKey, err := accountSecretKey(ctx, accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	secretAsBytes, err := ctx.GetStub().GetPrivateData(collection, secretKey)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to read from private data collection %s: %v", collection, err)
+	}
+	if secretAsBytes == nil {
+		return nil, nil
+	}
+
+	var secret AccountSecret
+	err = json.Unmarshal(secretAsBytes, &secret)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "the account secret of %s is corrupt: %v", accountKey, err)
+	}
+
+	return &secret, nil
+}
+
+// putAccountSecret stores the verifiers of the given credentials and keeps the token lookup index current.
+// An empty password or token keeps the stored verifier.
+func putAccountSecret(ctx contractapi.TransactionContextInterface, collection string, accountKey string,
+	password string, accountToken string) error {
+
+	var verifier *PasswordVerifier
+	if password != "" {
+		salt := newPasswordSalt(ctx, accountKey)
+		verifier = &PasswordVerifier{
+			Algorithm:  passwordHashAlgorithm,
+			Iterations: passwordHashIterations,
+			Salt:       hex.EncodeToString(salt),
+			Hash:       hex.EncodeToString(hashPassword(password, salt, passwordHashIterations)),
+		}
+	}
+
+	return writeAccountSecret(ctx, collection, accountKey, verifier, accountToken)
+}
+
+// writeAccountSecret stores the password verifier and the verifier of the token, keeping the stored ones
+// when verifier is nil or accountToken is empty
+func writeAccountSecret(ctx contractapi.TransactionContextInterface, collection string, accountKey string,
+	verifier *PasswordVerifier, accountToken string) error {
+
+	previous, err := readAccountSecret(ctx, collection, accountKey)
+	if err != nil {
+		return err
+	}
+
+	secret := AccountSecret{DocType: "accountSecret"}
+	if previous != nil {
+		secret = *previous
+	}
+	secret.Version++
+
+	if verifier != nil {
+		secret.AccountPasswordHash = verifier.Hash
+		secret.AccountPasswordSalt = verifier.Salt
+		secret.AccountPasswordIterations = verifier.Iterations
+	}
+
+	if accountToken != "" {
+		tokenHash := hashAccountToken(accountToken)
+		err = putPrivateIndex(ctx, collection, accountTokenIndex, secret.AccountTokenHash, tokenHash, accountKey)
+		if err != nil {
+			return err
+		}
+		secret.AccountTokenHash = tokenHash
+	}
+
+	secretAsBytes, err := json.Marshal(secret)
+	if err != nil {
+		return err
+	}
+
+	secretKey, err := accountSecretKey(ctx, accountKey)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutPrivateData(collection, secretKey, secretAsBytes)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to write to private data collection %s: %v", collection, err)
+	}
+
+	return nil
+}
+
+// ReadAccountPasswordHash returns the salted password verifier of an account owned by the submitter.
+// The verifier is only readable on peers of the organization that owns the account.
+func (s *SmartContract) ReadAccountPasswordHash(ctx contractapi.TransactionContextInterface, accountKey string) (*PasswordVerifier, error) {
+	account, err := requireAccountOwner(ctx, accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := readAccountSecret(ctx, implicitCollection(account.AccountMSPID), accountKey)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.AccountPasswordHash == "" {
+		return nil, ledgerErrorf(ErrNotFound, "the account %s has no stored password", accountKey)
+	}
+
+	// secrets stored before the chaincode hashed passwords hold the bcrypt hash the client computed
+	if secret.AccountPasswordSalt == "" {
+		return &PasswordVerifier{Algorithm: "bcrypt", Hash: secret.AccountPasswordHash, Version: secret.Version}, nil
+	}
+
+	return &PasswordVerifier{
+		Algorithm:  passwordHashAlgorithm,
+		Iterations: secret.AccountPasswordIterations,
+		Salt:       secret.AccountPasswordSalt,
+		Hash:       secret.AccountPasswordHash,
+		Version:    secret.Version,
+	}, nil
+}
+
+// ScrubAccounts moves credentials and personal details of accounts written before they were kept off the
+// ledger into the submitting organization's private data collection and rewrites the public documents
+// without them. It processes at most pageSize accounts and returns how many were scrubbed; call it until
+// it returns 0.
+func (s *SmartContract) ScrubAccounts(ctx contractapi.TransactionContextInterface, pageSize int) (int, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if pageSize <= 0 {
+		return 0, ledgerErrorf(ErrValidationFailed, "page size must be positive")
+	}
+
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// only accounts of the submitting organization, or accounts never bound to one, can be
+	// moved into its collection
+	query := newSelector("account")
+	query["$and"] = []interface{}{
+		map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"AccountPassword": map[string]interface{}{"$exists": true}},
+			map[string]interface{}{"AccountToken": map[string]interface{}{"$exists": true}},
+			map[string]interface{}{"AccountName": map[string]interface{}{"$exists": true}},
+			map[string]interface{}{"AccountEmail": map[string]interface{}{"$exists": true}},
+			map[string]interface{}{"AccountPhoneNumber": map[string]interface{}{"$exists": true}},
+		}},
+		map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"AccountMSPID": map[string]interface{}{"$exists": false}},
+			map[string]interface{}{"AccountMSPID": ""},
+			map[string]interface{}{"AccountMSPID": caller.mspID},
+		}},
+	}
+	queryString, err := query.queryString()
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return 0, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	collection := implicitCollection(caller.mspID)
+	var scrubbedKeys []string
+	for len(scrubbedKeys) < pageSize && resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return 0, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+
+		var legacy legacyAccount
+		err = json.Unmarshal(queryResult.Value, &legacy)
+		if err != nil {
+			return 0, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
+		}
+
+		if legacy.AccountPassword != nil || legacy.AccountToken != nil {
+			err = putLegacyAccountSecret(ctx, collection, queryResult.Key, &legacy)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if legacy.AccountName != nil || legacy.AccountEmail != nil || legacy.AccountPhoneNumber != nil {
+			details := AccountDetails{
+				AccountName:        stringValue(legacy.AccountName),
+				AccountEmail:       stringValue(legacy.AccountEmail),
+				AccountPhoneNumber: stringValue(legacy.AccountPhoneNumber),
+			}
+			err = putAccountDetails(ctx, collection, queryResult.Key, &details)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// re-marshalling through Account drops the private fields
+		var account Account
+		err = json.Unmarshal(queryResult.Value, &account)
+		if err != nil {
+			return 0, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
+		}
+		account.Version++
+		accountAsBytes, err := json.Marshal(account)
+		if err != nil {
+			return 0, err
+		}
+		err = putDocument(ctx, queryResult.Key, accountAsBytes)
+		if err != nil {
+			return 0, err
+		}
+
+		scrubbedKeys = append(scrubbedKeys, queryResult.Key)
+	}
+
+	if len(scrubbedKeys) == 0 {
+		return 0, nil
+	}
+
+	return len(scrubbedKeys), emitEvent(ctx, EventAccountsScrubbed, &LedgerEvent{Keys: scrubbedKeys, DocType: "account"})
+}
+
+// bcryptPattern matches the bcrypt hashes that earlier clients computed and stored as AccountPassword
+var bcryptPattern = regexp.MustCompile(`^\$2[aby]?\$[0-9]{2}\$[./A-Za-z0-9]{53}$`)
+
+// putLegacyAccountSecret moves the credentials of a legacy account into the collection. A bcrypt hash is
+// already a salted verifier and is kept, so the account's owner can still log in; any other password was
+// stored in plain text and is hashed like a new one.
+func putLegacyAccountSecret(ctx contractapi.TransactionContextInterface, collection string, accountKey string,
+	legacy *legacyAccount) error {
+
+	password := stringValue(legacy.AccountPassword)
+	if !bcryptPattern.MatchString(password) {
+		return putAccountSecret(ctx, collection, accountKey, password, stringValue(legacy.AccountToken))
+	}
+
+	return writeAccountSecret(ctx, collection, accountKey, &PasswordVerifier{Algorithm: "bcrypt", Hash: password},
+		stringValue(legacy.AccountToken))
+}
+
+// ClaimAccount binds a legacy account, which was written before accounts were bound to identities, to the
+// client with given certificate ID in the submitting administrator's organization. ScrubAccounts moves the
+// credentials of such accounts into that organization's collection, where its owner can then read them.
+// Accounts already bound to an identity cannot be claimed.
+func (s *SmartContract) ClaimAccount(ctx contractapi.TransactionContextInterface, accountKey string, clientID string,
+	expectedVersion int) error {
+
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID == "" {
+		return ledgerErrorf(ErrValidationFailed, "the client ID is required")
+	}
+
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	account, err := readAccount(ctx, accountKey)
+	if err != nil {
+		return err
+	}
+
+	err = requireVersion("account", accountKey, account.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+	if account.AccountMSPID != "" {
+		return ledgerErrorf(ErrConflict, "the account %s is already bound to an identity", accountKey)
+	}
+
+	account.AccountMSPID = caller.mspID
+	account.AccountClientID = clientID
+	account.SchemaVersion = currentSchemaVersion(accountObjectType)
+	account.Version++
+	accountAsBytes, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	err = putDocument(ctx, accountKey, accountAsBytes)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventAccountClaimed, &LedgerEvent{Key: accountKey, DocType: account.DocType})
+}
+
+// stringValue dereferences an optional legacy field
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
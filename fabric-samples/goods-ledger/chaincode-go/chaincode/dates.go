@@ -0,0 +1,158 @@
+package chaincode
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// calendarDateLayout is the layout of a date without a time of day
+const calendarDateLayout = "2006-01-02"
+
+// ledgerDateLayouts lists the date formats accepted in stored documents
+var ledgerDateLayouts = []string{time.RFC3339, calendarDateLayout}
+
+// isCalendarDate returns true when value is a date without a time of day, which stands for the whole day
+func isCalendarDate(value string) bool {
+	_, err := time.Parse(calendarDateLayout, value)
+	return err == nil
+}
+
+// parseLedgerDate parses a date stored in a document
+func parseLedgerDate(value string) (time.Time, error) {
+	for _, layout := range ledgerDateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, ledgerErrorf(ErrValidationFailed, "the date %q is not in RFC 3339 format", value)
+}
+
+// normalizeLedgerDate parses a date passed to a transaction and returns it in the format the chaincode stores
+func normalizeLedgerDate(value string) (string, time.Time, error) {
+	date, err := parseLedgerDate(value)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return formatLedgerTime(date), date, nil
+}
+
+// parseExpiryDate parses a stored expiry date. A product is still good at its expiry date, so a date without
+// a time of day stands for the last second of that day rather than its start.
+func parseExpiryDate(value string) (time.Time, error) {
+	date, err := parseLedgerDate(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if isCalendarDate(value) {
+		date = date.AddDate(0, 0, 1).Add(-time.Second)
+	}
+
+	return date, nil
+}
+
+// normalizeExpiryDate parses an expiry date passed to a transaction and returns it in the format the chaincode
+// stores, keeping a date without a time of day valid through the end of that day
+func normalizeExpiryDate(value string) (string, time.Time, error) {
+	date, err := parseExpiryDate(value)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return formatLedgerTime(date), date, nil
+}
+
+// isExpiredAt returns true when the expiry date lies before t. Stored dates have whole seconds, so t is
+// compared the way expiredProductSelector compares it.
+func isExpiredAt(expiry time.Time, t time.Time) bool {
+	return t.Truncate(time.Second).After(expiry)
+}
+
+// validatePastDate normalizes a date that must not lie after the transaction timestamp
+func validatePastDate(ctx contractapi.TransactionContextInterface, name string, value string) (string, time.Time, error) {
+	normalized, date, err := normalizeLedgerDate(value)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if date.After(txTime) {
+		return "", time.Time{}, ledgerErrorf(ErrValidationFailed, "the %s %s is after the transaction timestamp", name, value)
+	}
+
+	return normalized, date, nil
+}
+
+// validateProductDates normalizes the manufacturing and expiry dates of a product. Products cannot be made in the
+// future nor expire before they were made. The expiry date is optional, and a date without a time of day is
+// stored as the last second of that day.
+func validateProductDates(ctx contractapi.TransactionContextInterface, manufacturingDate string, expiryDate string) (string, string, error) {
+	normalizedManufacturingDate, manufactured, err := validatePastDate(ctx, "manufacturing date", manufacturingDate)
+	if err != nil {
+		return "", "", err
+	}
+
+	if expiryDate == "" {
+		return normalizedManufacturingDate, "", nil
+	}
+
+	normalizedExpiryDate, expiry, err := normalizeExpiryDate(expiryDate)
+	if err != nil {
+		return "", "", err
+	}
+	if expiry.Before(manufactured) {
+		return "", "", ledgerErrorf(ErrValidationFailed, "the expiry date %s is before the manufacturing date %s", expiryDate, manufacturingDate)
+	}
+
+	return normalizedManufacturingDate, normalizedExpiryDate, nil
+}
+
+// requireNotExpired fails when the product expired before the transaction timestamp
+func requireNotExpired(ctx contractapi.TransactionContextInterface, productKey string, product *Product) error {
+	if product.ProductExpiryDate == "" {
+		return nil
+	}
+
+	expiry, err := parseExpiryDate(product.ProductExpiryDate)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if isExpiredAt(expiry, txTime) {
+		return ledgerErrorf(ErrExpired, "the product %s expired on %s and cannot be transferred", productKey, product.ProductExpiryDate)
+	}
+
+	return nil
+}
+
+// formatLedgerTime formats times written by the chaincode in UTC without fractional seconds, so they sort
+// as strings in selectors
+func formatLedgerTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// getTxTime returns the client-supplied timestamp of the current transaction, which is the same on every endorser
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, ledgerErrorf(ErrInternal, "failed to get transaction timestamp: %v", err)
+	}
+
+	txTime, err := ptypes.Timestamp(txTimestamp)
+	if err != nil {
+		return time.Time{}, ledgerErrorf(ErrInternal, "failed to get transaction timestamp: %v", err)
+	}
+
+	return txTime, nil
+}
@@ -0,0 +1,76 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductDates(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"account2":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+		"product1":      marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", ProductExpiryDate: "2020-09-01T00:00:00Z", DocType: "product"}),
+		"product2":      marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", ProductExpiryDate: "2020-09-13", DocType: "product"}),
+		"product3":      marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", ProductExpiryDate: "2020-09-13T12:26:39Z", DocType: "product"}),
+	}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.AddProduct(transactionContext, "account1", "manufacturer1", "", "factory1", "sku", "Soap", "cosmetics", "batch1", "1", "", "tomorrow", "", "product")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	_, err = goodsLedger.AddProduct(transactionContext, "account1", "manufacturer1", "", "factory1", "sku", "Soap", "cosmetics", "batch1", "1", "", "2020-10-01", "", "product")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	_, err = goodsLedger.AddProduct(transactionContext, "account1", "manufacturer1", "", "factory1", "sku", "Soap", "cosmetics", "batch1", "1", "", "2020-09-01", "2020-08-01", "product")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	_, err = goodsLedger.AddProduct(transactionContext, "account1", "manufacturer1", "", "factory1", "sku", "Soap", "cosmetics", "batch1", "1", "", "2020-09-01T08:00:00+06:00", "2021-09-01", "product")
+	require.NoError(t, err)
+
+	_, bytes := chaincodeStub.PutStateArgsForCall(0)
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(bytes, &product))
+	require.Equal(t, "2020-09-01T02:00:00Z", product.ProductManufacturingDate)
+	require.Equal(t, "2021-09-01T23:59:59Z", product.ProductExpiryDate)
+
+	err = goodsLedger.UpdateProductOwner(transactionContext, "product1", "account2", 0)
+	requireErrorCode(t, err, chaincode.ErrExpired)
+
+	// a date without a time of day is good through the end of that day, on the transaction day too
+	err = goodsLedger.UpdateProductOwner(transactionContext, "product2", "account2", 0)
+	require.NoError(t, err)
+
+	err = goodsLedger.UpdateProductOwner(transactionContext, "product3", "account2", 0)
+	requireErrorCode(t, err, chaincode.ErrExpired)
+}
+
+func TestQueryExpiredProducts(t *testing.T) {
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{}, "Org1MSP", "alice")
+	chaincodeStub.GetQueryResultReturns(&mocks.StateQueryIterator{}, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.QueryExpiredProducts(transactionContext)
+	require.NoError(t, err)
+
+	_, err = goodsLedger.QueryProductsExpiringBefore(transactionContext, "2021-01-01")
+	require.NoError(t, err)
+
+	_, err = goodsLedger.QueryProductsExpiringBefore(transactionContext, "next year")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	var query struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(chaincodeStub.GetQueryResultArgsForCall(0)), &query))
+	require.Equal(t, map[string]interface{}{"$gt": "", "$lt": "2020-09-13T12:26:40Z"}, query.Selector["ProductExpiryDate"])
+
+	require.NoError(t, json.Unmarshal([]byte(chaincodeStub.GetQueryResultArgsForCall(1)), &query))
+	require.Equal(t, map[string]interface{}{"$gt": "", "$lt": "2021-01-01T00:00:00Z"}, query.Selector["ProductExpiryDate"])
+}
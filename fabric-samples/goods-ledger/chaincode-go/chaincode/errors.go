@@ -0,0 +1,109 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// ErrorCode classifies why a transaction failed so clients need not parse error messages
+type ErrorCode string
+
+// Error codes returned in LedgerError payloads
+const (
+	ErrNotFound         ErrorCode = "NOT_FOUND"
+	ErrAlreadyExists    ErrorCode = "ALREADY_EXISTS"
+	ErrUnauthorized     ErrorCode = "UNAUTHORIZED"
+	ErrValidationFailed ErrorCode = "VALIDATION_FAILED"
+	ErrConflict         ErrorCode = "CONFLICT"
+	ErrRecalled         ErrorCode = "RECALLED"
+	ErrExpired          ErrorCode = "EXPIRED"
+	ErrTooManyResults   ErrorCode = "TOO_MANY_RESULTS"
+	ErrInternal         ErrorCode = "INTERNAL"
+)
+
+// LedgerError is the error returned by contract transactions. Its message is the JSON payload clients receive.
+// Validation failures list every rejected input field in FieldErrors.
+type LedgerError struct {
+	Code        ErrorCode    `json:"Code"`
+	Message     string       `json:"Message"`
+	FieldErrors []FieldError `json:"FieldErrors,omitempty"`
+}
+
+// Error renders the error as its JSON payload
+func (e *LedgerError) Error() string {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+
+	return string(payload)
+}
+
+// ledgerErrorf returns a LedgerError with given code and formatted message
+func ledgerErrorf(code ErrorCode, format string, args ...interface{}) error {
+	return &LedgerError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCodeOf returns the code of a LedgerError. Any other error is reported as INTERNAL.
+func ErrorCodeOf(err error) ErrorCode {
+	var ledgerError *LedgerError
+	if errors.As(err, &ledgerError) {
+		return ledgerError.Code
+	}
+
+	return ErrInternal
+}
+
+// ledgerErrorChaincode turns every failed response into a LedgerError payload, so failures raised by the
+// shim or the contract API rather than the contract itself are reported as INTERNAL
+type ledgerErrorChaincode struct {
+	shim.Chaincode
+}
+
+// NewChaincode creates the goods-ledger chaincode
+func NewChaincode() (shim.Chaincode, error) {
+	contractChaincode, err := contractapi.NewChaincode(&SmartContract{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ledgerErrorChaincode{Chaincode: contractChaincode}, nil
+}
+
+// Init passes the instantiate request to the contract and formats its error
+func (cc *ledgerErrorChaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return formatErrorResponse(cc.Chaincode.Init(stub))
+}
+
+// Invoke passes the transaction to the contract and formats its error
+func (cc *ledgerErrorChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return formatErrorResponse(cc.Chaincode.Invoke(stub))
+}
+
+// formatErrorResponse wraps the message of a failed response in a LedgerError unless it already is one
+func formatErrorResponse(response peer.Response) peer.Response {
+	if response.Status < shim.ERRORTHRESHOLD {
+		return response
+	}
+
+	var ledgerError LedgerError
+	err := json.Unmarshal([]byte(response.Message), &ledgerError)
+	if err == nil && ledgerError.Code != "" {
+		return response
+	}
+
+	// arguments that do not match the published transaction schema never reach the contract
+	code := ErrInternal
+	if strings.HasPrefix(response.Message, "Error managing parameter") {
+		code = ErrValidationFailed
+	}
+
+	response.Message = (&LedgerError{Code: code, Message: response.Message}).Error()
+	return response
+}
@@ -0,0 +1,29 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorPayload(t *testing.T) {
+	goodsLedger, err := chaincode.NewChaincode()
+	require.NoError(t, err)
+
+	chaincodeStub := &mocks.ChaincodeStub{}
+	chaincodeStub.GetFunctionAndParametersReturns("ReadAsset", []string{"asset1"})
+	response := goodsLedger.Invoke(chaincodeStub)
+
+	var ledgerError chaincode.LedgerError
+	require.NoError(t, json.Unmarshal([]byte(response.Message), &ledgerError))
+	require.Equal(t, chaincode.LedgerError{Code: chaincode.ErrNotFound, Message: "the asset asset1 does not exist"}, ledgerError)
+
+	chaincodeStub.GetFunctionAndParametersReturns("NoSuchFunction", nil)
+	response = goodsLedger.Invoke(chaincodeStub)
+
+	require.NoError(t, json.Unmarshal([]byte(response.Message), &ledgerError))
+	require.Equal(t, chaincode.ErrInternal, ledgerError.Code)
+}
@@ -0,0 +1,71 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Names of the chaincode events emitted by goods-ledger transactions
+const (
+	EventAccountRegistered         = "AccountRegistered"
+	EventAccountUpdated            = "AccountUpdated"
+	EventAccountCredentialsUpdated = "AccountCredentialsUpdated"
+	EventAccountDetailsUpdated     = "AccountDetailsUpdated"
+	EventAccountsScrubbed          = "AccountsScrubbed"
+	EventAccountClaimed            = "AccountClaimed"
+	EventManufacturerAdded         = "ManufacturerAdded"
+	EventManufacturerUpdated       = "ManufacturerUpdated"
+	EventFactoryAdded              = "FactoryAdded"
+	EventFactoryUpdated            = "FactoryUpdated"
+	EventProductCreated            = "ProductCreated"
+	EventProductUpdated            = "ProductUpdated"
+	EventProductOwnerChanged       = "ProductOwnerChanged"
+	EventProductReportedStolen     = "ProductReportedStolen"
+	EventProductTransferOffered    = "ProductTransferOffered"
+	EventProductTransferCancelled  = "ProductTransferCancelled"
+	EventBatchMinted               = "BatchMinted"
+	EventRecallIssued              = "RecallIssued"
+	EventRecallClosed              = "RecallClosed"
+	EventDocumentsMigrated         = "DocumentsMigrated"
+)
+
+// LedgerEvent is the payload of the chaincode events emitted by goods-ledger transactions.
+// Keys is only set when the transaction changed several documents, and then lists the documents
+// other than Key that changed, such as the products of a minted batch or a recall.
+type LedgerEvent struct {
+	Key               string    `json:"Key"`
+	Keys              []string  `json:"Keys,omitempty"`
+	DocType           string    `json:"DocType"`
+	ManufacturerID    string    `json:"ManufacturerID,omitempty"`
+	FactoryID         string    `json:"FactoryID,omitempty"`
+	OldOwnerAccountID string    `json:"OldOwnerAccountID,omitempty"`
+	NewOwnerAccountID string    `json:"NewOwnerAccountID,omitempty"`
+	TxID              string    `json:"TxID"`
+	Timestamp         time.Time `json:"Timestamp"`
+}
+
+// emitEvent stamps the event with the transaction ID and timestamp and sets it on the transaction.
+// Fabric keeps only one event per transaction, so every transaction emits at most one.
+func emitEvent(ctx contractapi.TransactionContextInterface, eventName string, event *LedgerEvent) error {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	event.TxID = ctx.GetStub().GetTxID()
+	event.Timestamp = txTime
+
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(eventName, eventAsBytes)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to set event %s: %v", eventName, err)
+	}
+
+	return nil
+}
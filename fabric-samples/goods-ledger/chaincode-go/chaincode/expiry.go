@@ -0,0 +1,77 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// QueryExpiredProducts returns the products whose expiry date has passed at the transaction timestamp
+func (s *SmartContract) QueryExpiredProducts(ctx contractapi.TransactionContextInterface) ([]*Product, error) {
+	query, err := expiredProductSelector(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return getProductQueryResultForSelector(ctx, query)
+}
+
+// QueryExpiredProductsWithPagination returns one page of the results of QueryExpiredProducts.
+func (s *SmartContract) QueryExpiredProductsWithPagination(ctx contractapi.TransactionContextInterface,
+	pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	query, err := expiredProductSelector(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return getProductQueryResultForSelectorWithPagination(ctx, query, pageSize, bookmark)
+}
+
+// QueryProductsExpiringBefore returns the products that expire before the given date
+func (s *SmartContract) QueryProductsExpiringBefore(ctx contractapi.TransactionContextInterface,
+	date string) ([]*Product, error) {
+
+	query, err := productsExpiringBeforeSelector(date)
+	if err != nil {
+		return nil, err
+	}
+
+	return getProductQueryResultForSelector(ctx, query)
+}
+
+// QueryProductsExpiringBeforeWithPagination returns one page of the results of QueryProductsExpiringBefore.
+func (s *SmartContract) QueryProductsExpiringBeforeWithPagination(ctx contractapi.TransactionContextInterface,
+	date string, pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	query, err := productsExpiringBeforeSelector(date)
+	if err != nil {
+		return nil, err
+	}
+
+	return getProductQueryResultForSelectorWithPagination(ctx, query, pageSize, bookmark)
+}
+
+// expiredProductSelector matches products whose expiry date is before the transaction timestamp. Products
+// are still good at their expiry date, which requireNotExpired and VerifyProduct agree with.
+func expiredProductSelector(ctx contractapi.TransactionContextInterface) (selector, error) {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// products without an expiry date store an empty string, which sorts before every date
+	return newSelector(productObjectType).
+		greaterThan("ProductExpiryDate", "").
+		lessThan("ProductExpiryDate", formatLedgerTime(txTime)), nil
+}
+
+// productsExpiringBeforeSelector matches products with an expiry date before the given date
+func productsExpiringBeforeSelector(date string) (selector, error) {
+	normalized, _, err := normalizeLedgerDate(date)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSelector(productObjectType).
+		greaterThan("ProductExpiryDate", "").
+		lessThan("ProductExpiryDate", normalized), nil
+}
@@ -0,0 +1,69 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ProductHistoryRecord describes one committed version of a product
+type ProductHistoryRecord struct {
+	Record            *Product  `json:"Record"`
+	TxID              string    `json:"TxID"`
+	Timestamp         time.Time `json:"Timestamp"`
+	SubmitterMSPID    string    `json:"SubmitterMSPID"`
+	SubmitterClientID string    `json:"SubmitterClientID"`
+	IsDelete          bool      `json:"IsDelete"`
+}
+
+// GetProductHistory returns every committed version of the product with given key
+// so clients can show the full custody chain of a product.
+func (s *SmartContract) GetProductHistory(ctx contractapi.TransactionContextInterface, productKey string) ([]ProductHistoryRecord, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(productKey)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to read product history: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var records []ProductHistoryRecord
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "failed to read product history: %v", err)
+		}
+
+		record := ProductHistoryRecord{
+			TxID:     response.TxId,
+			IsDelete: response.IsDelete,
+		}
+
+		if response.Timestamp != nil {
+			record.Timestamp, err = ptypes.Timestamp(response.Timestamp)
+			if err != nil {
+				return nil, ledgerErrorf(ErrInternal, "failed to read product history: %v", err)
+			}
+		}
+
+		if len(response.Value) > 0 {
+			// any key can be looked up, so every version must be a product, not an account or an index entry
+			var product Product
+			err = json.Unmarshal(response.Value, &product)
+			if err != nil || product.DocType != productObjectType {
+				return nil, ledgerErrorf(ErrNotFound, "the product %s does not exist", productKey)
+			}
+			record.Record = &product
+			record.SubmitterMSPID = product.ProductUpdaterMSPID
+			record.SubmitterClientID = product.ProductUpdaterClientID
+		}
+
+		records = append(records, record)
+	}
+
+	if records == nil {
+		return nil, ledgerErrorf(ErrNotFound, "the product %s does not exist", productKey)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,60 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProductHistory(t *testing.T) {
+	product := &chaincode.Product{ProductOwnerAccountID: "account2", ProductUpdaterMSPID: "Org1MSP", ProductUpdaterClientID: "alice", DocType: "product"}
+
+	iterator := &mocks.HistoryQueryIterator{}
+	iterator.HasNextReturnsOnCall(0, true)
+	iterator.HasNextReturnsOnCall(1, true)
+	iterator.HasNextReturnsOnCall(2, false)
+	iterator.NextReturnsOnCall(0, &queryresult.KeyModification{TxId: "tx2", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 20}}, nil)
+	iterator.NextReturnsOnCall(1, &queryresult.KeyModification{TxId: "tx1", Value: marshalDocument(t, product), Timestamp: &timestamp.Timestamp{Seconds: 10}}, nil)
+
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{}, "Org2MSP", "bob")
+	chaincodeStub.GetHistoryForKeyReturns(iterator, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	records, err := goodsLedger.GetProductHistory(transactionContext, "product1")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.True(t, records[0].IsDelete)
+	require.Nil(t, records[0].Record)
+	require.Equal(t, "tx1", records[1].TxID)
+	require.Equal(t, int64(10), records[1].Timestamp.Unix())
+	require.Equal(t, "Org1MSP", records[1].SubmitterMSPID)
+	require.Equal(t, "alice", records[1].SubmitterClientID)
+	require.Equal(t, product, records[1].Record)
+
+	accountHistory := &mocks.HistoryQueryIterator{}
+	accountHistory.HasNextReturnsOnCall(0, true)
+	accountHistory.NextReturns(&queryresult.KeyModification{TxId: "tx3", Value: marshalDocument(t, &chaincode.Account{DocType: "account"})}, nil)
+	chaincodeStub.GetHistoryForKeyReturns(accountHistory, nil)
+	_, err = goodsLedger.GetProductHistory(transactionContext, "account1")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	indexEntryHistory := &mocks.HistoryQueryIterator{}
+	indexEntryHistory.HasNextReturnsOnCall(0, true)
+	indexEntryHistory.NextReturns(&queryresult.KeyModification{TxId: "tx3", Value: []byte{0x00}}, nil)
+	chaincodeStub.GetHistoryForKeyReturns(indexEntryHistory, nil)
+	_, err = goodsLedger.GetProductHistory(transactionContext, "\x00product~owner~key\x00account1\x00product1\x00")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	chaincodeStub.GetHistoryForKeyReturns(&mocks.HistoryQueryIterator{}, nil)
+	_, err = goodsLedger.GetProductHistory(transactionContext, "product2")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	chaincodeStub.GetHistoryForKeyReturns(nil, fmt.Errorf("history database disabled"))
+	_, err = goodsLedger.GetProductHistory(transactionContext, "product1")
+	requireErrorCode(t, err, chaincode.ErrInternal)
+}
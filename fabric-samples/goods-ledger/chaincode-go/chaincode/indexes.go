@@ -0,0 +1,445 @@
+package chaincode
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Composite key indexes maintained by the chaincode. Equality lookups go through these with
+// GetStateByPartialCompositeKey, so they work on LevelDB peers as well as CouchDB peers. Only the
+// queries that compare dates still need CouchDB: QueryExpiredProducts, QueryProductsExpiringBefore
+// and their WithPagination variants, SearchProducts, and the administrative MigrateDocuments and
+// ScrubAccounts. Transfer offer lookups leave out expired offers in the chaincode instead.
+// Accounts are looked up by email and token through the private indexes of their organization.
+const (
+	accountByUsernameIndex          = "account~username~key"
+	manufacturerByAccountIndex      = "manufacturer~account~key"
+	manufacturerByTradeLicenceIndex = "manufacturer~licence~key"
+	factoryByIDIndex                = "factory~id~key"
+	factoryByManufacturerIndex      = "factory~manufacturer~key"
+	productByIDIndex                = "product~id~key"
+	productByOwnerIndex             = "product~owner~key"
+	productByManufacturerIndex      = "product~manufacturer~key"
+	productByFactoryIndex           = "product~factory~key"
+	productByBatchIndex             = "product~manufacturer~batch~key"
+	productByOwnerRecallIndex       = "product~owner~recall~key"
+	batchByManufacturerIndex        = "batch~manufacturer~key"
+	recallByStatusIndex             = "recall~status~key"
+	transferOfferByToAccountIndex   = "transferOffer~to~key"
+	transferOfferByFromAccountIndex = "transferOffer~from~key"
+)
+
+// indexEntryValue is stored under every index entry; the entry key alone carries the lookup
+var indexEntryValue = []byte{0x00}
+
+// documentIndex is a composite key index over fields of a DocType. Each document gets the entry
+// {name, field values..., document key}, unless one of the fields is empty.
+type documentIndex struct {
+	name   string
+	fields []string
+}
+
+// documentIndexes lists the indexes maintained for each DocType
+var documentIndexes = map[string][]documentIndex{
+	accountObjectType: {
+		{accountByUsernameIndex, []string{"AccountUsername"}},
+	},
+	manufacturerObjectType: {
+		{manufacturerByAccountIndex, []string{"ManufacturerAccountID"}},
+		{manufacturerByTradeLicenceIndex, []string{"ManufacturerTradeLicenceID"}},
+	},
+	factoryObjectType: {
+		{factoryByIDIndex, []string{"FactoryID"}},
+		{factoryByManufacturerIndex, []string{"FactoryManufacturerID"}},
+	},
+	productObjectType: {
+		{productByIDIndex, []string{"ProductID"}},
+		{productByOwnerIndex, []string{"ProductOwnerAccountID"}},
+		{productByManufacturerIndex, []string{"ProductManufacturerID"}},
+		{productByFactoryIndex, []string{"ProductFactoryID"}},
+		{productByBatchIndex, []string{"ProductManufacturerID", "ProductBatch"}},
+		{productByOwnerRecallIndex, []string{"ProductOwnerAccountID", "ProductRecallStatus"}},
+	},
+	batchObjectType: {
+		{batchByManufacturerIndex, []string{"BatchManufacturerID"}},
+	},
+	recallObjectType: {
+		{recallByStatusIndex, []string{"RecallStatus"}},
+	},
+	transferOfferObjectType: {
+		{transferOfferByToAccountIndex, []string{"ToAccountID"}},
+		{transferOfferByFromAccountIndex, []string{"FromAccountID"}},
+	},
+}
+
+// indexEntryKeys returns the keys of the index entries of a stored document; a missing document has none
+func indexEntryKeys(ctx contractapi.TransactionContextInterface, key string, documentAsBytes []byte) ([]string, error) {
+	if documentAsBytes == nil {
+		return nil, nil
+	}
+
+	var document map[string]interface{}
+	err := json.Unmarshal(documentAsBytes, &document)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", key, err)
+	}
+
+	docType, _ := document["DocType"].(string)
+	var entryKeys []string
+	for _, index := range documentIndexes[docType] {
+		attributes := make([]string, 0, len(index.fields)+1)
+		for _, field := range index.fields {
+			value, _ := document[field].(string)
+			if value == "" {
+				break
+			}
+			attributes = append(attributes, keyAttribute(value))
+		}
+		if len(attributes) < len(index.fields) {
+			continue
+		}
+
+		entryKey, err := createCompositeKey(ctx, index.name, append(attributes, keyAttribute(key)))
+		if err != nil {
+			return nil, err
+		}
+		entryKeys = append(entryKeys, entryKey)
+	}
+
+	return entryKeys, nil
+}
+
+// putDocument writes a document with its index entries and removes the entries of its previous version.
+// All entries are rewritten on every write, so re-putting a document also repairs its index entries.
+func putDocument(ctx contractapi.TransactionContextInterface, key string, documentAsBytes []byte) error {
+	previousAsBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to read from world state: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, documentAsBytes)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to put to world state: %v", err)
+	}
+
+	return updateIndexEntries(ctx, key, previousAsBytes, documentAsBytes)
+}
+
+// deleteDocument deletes a document together with its index entries
+func deleteDocument(ctx contractapi.TransactionContextInterface, key string) error {
+	previousAsBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to read from world state: %v", err)
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to delete from world state: %v", err)
+	}
+
+	return updateIndexEntries(ctx, key, previousAsBytes, nil)
+}
+
+// updateIndexEntries replaces the index entries of the previous version of a document with those of
+// the new one; a nil document removes them all
+func updateIndexEntries(ctx contractapi.TransactionContextInterface, key string, previousAsBytes []byte, documentAsBytes []byte) error {
+	previousEntryKeys, err := indexEntryKeys(ctx, key, previousAsBytes)
+	if err != nil {
+		return err
+	}
+
+	entryKeys, err := indexEntryKeys(ctx, key, documentAsBytes)
+	if err != nil {
+		return err
+	}
+
+	for _, previousEntryKey := range previousEntryKeys {
+		if containsString(entryKeys, previousEntryKey) {
+			continue
+		}
+		err = ctx.GetStub().DelState(previousEntryKey)
+		if err != nil {
+			return ledgerErrorf(ErrInternal, "failed to delete from world state: %v", err)
+		}
+	}
+
+	for _, entryKey := range entryKeys {
+		err = ctx.GetStub().PutState(entryKey, indexEntryValue)
+		if err != nil {
+			return ledgerErrorf(ErrInternal, "failed to put to world state: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// indexedDocumentIterator resolves the index entries of an iterator into the documents they point at,
+// so the constructXQueryResponseFromIterator helpers read index lookups like rich query results
+type indexedDocumentIterator struct {
+	shim.StateQueryIteratorInterface
+	ctx contractapi.TransactionContextInterface
+}
+
+// Next returns the document the next index entry points at
+func (iterator *indexedDocumentIterator) Next() (*queryresult.KV, error) {
+	entry, err := iterator.StateQueryIteratorInterface.Next()
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+	}
+
+	key, err := indexedDocumentKey(iterator.ctx, entry.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	documentAsBytes, err := iterator.ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to read from world state: %v", err)
+	}
+	if documentAsBytes == nil {
+		return nil, ledgerErrorf(ErrInternal, "the index entry %q points at the missing document %s", entry.Key, key)
+	}
+
+	return &queryresult.KV{Namespace: entry.Namespace, Key: key, Value: documentAsBytes}, nil
+}
+
+// indexedDocumentKey returns the key of the document an index entry points at
+func indexedDocumentKey(ctx contractapi.TransactionContextInterface, entryKey string) (string, error) {
+	_, attributes, err := ctx.GetStub().SplitCompositeKey(entryKey)
+	if err != nil {
+		return "", ledgerErrorf(ErrInternal, "failed to split composite key: %v", err)
+	}
+	if len(attributes) == 0 {
+		return "", ledgerErrorf(ErrInternal, "the index entry %q has no document key", entryKey)
+	}
+
+	return keyFromAttribute(attributes[len(attributes)-1]), nil
+}
+
+// getIndexedDocuments returns an iterator over the documents whose index entries start with the given values
+func getIndexedDocuments(ctx contractapi.TransactionContextInterface, index string, values ...string) (shim.StateQueryIteratorInterface, error) {
+	entriesIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, keyAttributes(values))
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+
+	return &indexedDocumentIterator{StateQueryIteratorInterface: entriesIterator, ctx: ctx}, nil
+}
+
+// getIndexedDocumentsWithPagination returns one page of getIndexedDocuments.
+// Paginated queries are only supported in read-only transactions.
+func getIndexedDocumentsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string,
+	index string, values ...string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entriesIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(index, keyAttributes(values), pageSize, bookmark)
+	if err != nil {
+		return nil, nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+
+	return &indexedDocumentIterator{StateQueryIteratorInterface: entriesIterator, ctx: ctx}, responseMetadata, nil
+}
+
+// keyAttributes escapes index lookup values, which may be keys of other documents
+func keyAttributes(values []string) []string {
+	attributes := make([]string, 0, len(values))
+	for _, value := range values {
+		attributes = append(attributes, keyAttribute(value))
+	}
+
+	return attributes
+}
+
+func getAccountQueryResultForIndex(ctx contractapi.TransactionContextInterface, index string, values ...string) ([]*Account, error) {
+	resultsIterator, err := getIndexedDocuments(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructAccountQueryResponseFromIterator(resultsIterator)
+}
+
+func getManufacturerQueryResultForIndex(ctx contractapi.TransactionContextInterface, index string, values ...string) ([]*Manufacturer, error) {
+	resultsIterator, err := getIndexedDocuments(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructManufacturerQueryResponseFromIterator(resultsIterator)
+}
+
+func getFactoryQueryResultForIndex(ctx contractapi.TransactionContextInterface, index string, values ...string) ([]*Factory, error) {
+	resultsIterator, err := getIndexedDocuments(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructFactoryQueryResponseFromIterator(resultsIterator)
+}
+
+func getProductQueryResultForIndex(ctx contractapi.TransactionContextInterface, index string, values ...string) ([]*Product, error) {
+	resultsIterator, err := getIndexedDocuments(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructProductQueryResponseFromIterator(resultsIterator)
+}
+
+func getBatchQueryResultForIndex(ctx contractapi.TransactionContextInterface, index string, values ...string) ([]*Batch, error) {
+	resultsIterator, err := getIndexedDocuments(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructBatchQueryResponseFromIterator(resultsIterator)
+}
+
+func getRecallQueryResultForIndex(ctx contractapi.TransactionContextInterface, index string, values ...string) ([]*Recall, error) {
+	resultsIterator, err := getIndexedDocuments(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructRecallQueryResponseFromIterator(resultsIterator)
+}
+
+func getAccountQueryResultForIndexWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string,
+	index string, values ...string) (*PaginatedAccountQueryResult, error) {
+
+	resultsIterator, responseMetadata, err := getIndexedDocumentsWithPagination(ctx, pageSize, bookmark, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	accounts, err := constructAccountQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedAccountQueryResult{
+		Records:      accounts,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
+func getManufacturerQueryResultForIndexWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string,
+	index string, values ...string) (*PaginatedManufacturerQueryResult, error) {
+
+	resultsIterator, responseMetadata, err := getIndexedDocumentsWithPagination(ctx, pageSize, bookmark, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	manufacturers, err := constructManufacturerQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedManufacturerQueryResult{
+		Records:      manufacturers,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
+func getFactoryQueryResultForIndexWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string,
+	index string, values ...string) (*PaginatedFactoryQueryResult, error) {
+
+	resultsIterator, responseMetadata, err := getIndexedDocumentsWithPagination(ctx, pageSize, bookmark, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	factories, err := constructFactoryQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedFactoryQueryResult{
+		Records:      factories,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
+func getProductQueryResultForIndexWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string,
+	index string, values ...string) (*PaginatedProductQueryResult, error) {
+
+	resultsIterator, responseMetadata, err := getIndexedDocumentsWithPagination(ctx, pageSize, bookmark, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	products, err := constructProductQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedProductQueryResult{
+		Records:      products,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
+func getBatchQueryResultForIndexWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string,
+	index string, values ...string) (*PaginatedBatchQueryResult, error) {
+
+	resultsIterator, responseMetadata, err := getIndexedDocumentsWithPagination(ctx, pageSize, bookmark, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	batches, err := constructBatchQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedBatchQueryResult{
+		Records:      batches,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
+func getRecallQueryResultForIndexWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string,
+	index string, values ...string) (*PaginatedRecallQueryResult, error) {
+
+	resultsIterator, responseMetadata, err := getIndexedDocumentsWithPagination(ctx, pageSize, bookmark, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	recalls, err := constructRecallQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedRecallQueryResult{
+		Records:      recalls,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductIndexes(t *testing.T) {
+	manufacturerKey := "\x00manufacturer\x00tx0\x00"
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"account2":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		manufacturerKey: marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"manufacturer2": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Other", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: manufacturerKey, DocType: "factory"}),
+	}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		worldState[key] = value
+		return nil
+	}
+	chaincodeStub.DelStateStub = func(key string) error {
+		delete(worldState, key)
+		return nil
+	}
+
+	goodsLedger := chaincode.SmartContract{}
+	productKey, err := goodsLedger.AddProduct(transactionContext, "account1", manufacturerKey, "", "factory1", "sku", "Soap", "cosmetics",
+		"batch1", "7", "", "2020-09-01", "", "product")
+	require.NoError(t, err)
+
+	products, err := goodsLedger.QueryProductbyManufacturerID(transactionContext, manufacturerKey)
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	require.Equal(t, "Soap", products[0].ProductName)
+
+	products, err = goodsLedger.QueryProductbyOwnerAccountID(transactionContext, "account1")
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+
+	err = goodsLedger.UpdateProductOwner(transactionContext, productKey, "account2", 1)
+	require.NoError(t, err)
+
+	products, err = goodsLedger.QueryProductbyOwnerAccountID(transactionContext, "account1")
+	require.NoError(t, err)
+	require.Empty(t, products)
+
+	products, err = goodsLedger.QueryProductbyOwnerAccountID(transactionContext, "account2")
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+
+	products, err = goodsLedger.QueryProductbyCode(transactionContext, productKey)
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	require.Equal(t, "account2", products[0].ProductOwnerAccountID)
+
+	err = goodsLedger.UpdateFactory(transactionContext, "factory1", "manufacturer2", "Plant", "Dhaka", 0)
+	requireErrorCode(t, err, chaincode.ErrConflict)
+}
@@ -0,0 +1,527 @@
+package chaincode
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The v2 transactions take one JSON object per entity. Their fields are required unless tagged optional in the
+// contract metadata, and since the published schema allows no other properties, clients cannot supply the
+// Version, SchemaVersion or DocType the chaincode maintains itself.
+
+// AccountInput is the input of CreateAccount
+type AccountInput struct {
+	AccountType                string `json:"AccountType"`
+	AccountUsername            string `json:"AccountUsername"`
+	AccountOwnerManufacturerID string `json:"AccountOwnerManufacturerID" metadata:",optional"`
+}
+
+// ManufacturerDetails are the fields of a manufacturer its owner may update
+type ManufacturerDetails struct {
+	ManufacturerName           string `json:"ManufacturerName"`
+	ManufacturerTradeLicenceID string `json:"ManufacturerTradeLicenceID"`
+	ManufacturerLocation       string `json:"ManufacturerLocation" metadata:",optional"`
+	ManufacturerFoundingDate   string `json:"ManufacturerFoundingDate"`
+}
+
+// ManufacturerInput is the input of CreateManufacturer
+type ManufacturerInput struct {
+	ManufacturerAccountID string `json:"ManufacturerAccountID"`
+	ManufacturerDetails
+}
+
+// FactoryDetails are the fields of a factory the owner of its manufacturer may update
+type FactoryDetails struct {
+	FactoryManufacturerID string `json:"FactoryManufacturerID"`
+	FactoryName           string `json:"FactoryName"`
+	FactoryLocation       string `json:"FactoryLocation" metadata:",optional"`
+}
+
+// FactoryInput is the input of CreateFactory
+type FactoryInput struct {
+	FactoryID string `json:"FactoryID"`
+	FactoryDetails
+}
+
+// ProductDetails are the fields of a product the owner of its manufacturer may update,
+// the batch and serial must repeat the stored values
+type ProductDetails struct {
+	ProductOwnerAccountID        string `json:"ProductOwnerAccountID"`
+	ProductFactoryID             string `json:"ProductFactoryID"`
+	ProductName                  string `json:"ProductName"`
+	ProductType                  string `json:"ProductType"`
+	ProductBatch                 string `json:"ProductBatch"`
+	ProductSerialinBatch         string `json:"ProductSerialinBatch"`
+	ProductManufacturingLocation string `json:"ProductManufacturingLocation" metadata:",optional"`
+	ProductManufacturingDate     string `json:"ProductManufacturingDate"`
+	ProductExpiryDate            string `json:"ProductExpiryDate" metadata:",optional"`
+}
+
+// ProductInput is the input of CreateProduct
+type ProductInput struct {
+	ProductManufacturerID   string `json:"ProductManufacturerID"`
+	ProductManufacturerName string `json:"ProductManufacturerName" metadata:",optional"`
+	ProductID               string `json:"ProductID"`
+	ProductDetails
+}
+
+// CreateAccount registers an account for the submitting identity and returns its key.
+// The credentials and personal details are passed in the transient map as for RegisterAccount.
+func (s *SmartContract) CreateAccount(ctx contractapi.TransactionContextInterface, input AccountInput) (string, error) {
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := getAccountSecretInput(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	details, err := getAccountDetailsInput(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	err = validationError(accountValidations.check(input), accountSecretValidations.check(secret), accountDetailsValidations.check(details))
+	if err != nil {
+		return "", err
+	}
+
+	if input.AccountOwnerManufacturerID != "" {
+		err = requireReference(ctx, "manufacturer", input.AccountOwnerManufacturerID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	accountKey, err := newDocumentKey(ctx, accountObjectType)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireAbsent(ctx, "account", accountKey)
+	if err != nil {
+		return "", err
+	}
+
+	account := Account{
+		AccountType:                input.AccountType,
+		AccountUsername:            input.AccountUsername,
+		AccountOwnerManufacturerID: input.AccountOwnerManufacturerID,
+		AccountMSPID:               caller.mspID,
+		AccountClientID:            caller.clientID,
+		SchemaVersion:              currentSchemaVersion(accountObjectType),
+		Version:                    1,
+		DocType:                    accountObjectType,
+	}
+	accountAsBytes, err := json.Marshal(account)
+	if err != nil {
+		return "", err
+	}
+
+	err = putAccountSecret(ctx, implicitCollection(caller.mspID), accountKey, secret.AccountPassword, secret.AccountToken)
+	if err != nil {
+		return "", err
+	}
+
+	err = putAccountDetails(ctx, implicitCollection(caller.mspID), accountKey, details)
+	if err != nil {
+		return "", err
+	}
+
+	err = putDocument(ctx, accountKey, accountAsBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return accountKey, emitEvent(ctx, EventAccountRegistered, &LedgerEvent{
+		Key:            accountKey,
+		DocType:        accountObjectType,
+		ManufacturerID: input.AccountOwnerManufacturerID,
+	})
+}
+
+// CreateManufacturer adds a manufacturer owned by an account of the submitting identity and returns its key
+func (s *SmartContract) CreateManufacturer(ctx contractapi.TransactionContextInterface, input ManufacturerInput) (string, error) {
+	err := validationError(manufacturerValidations.check(input))
+	if err != nil {
+		return "", err
+	}
+
+	foundingDate, _, err := validatePastDate(ctx, "founding date", input.ManufacturerFoundingDate)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = requireAccountOwner(ctx, input.ManufacturerAccountID)
+	if err != nil {
+		return "", err
+	}
+
+	manufacturerKey, err := newDocumentKey(ctx, manufacturerObjectType)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireAbsent(ctx, "manufacturer", manufacturerKey)
+	if err != nil {
+		return "", err
+	}
+
+	manufacturer := Manufacturer{
+		ManufacturerAccountID:      input.ManufacturerAccountID,
+		ManufacturerName:           input.ManufacturerName,
+		ManufacturerTradeLicenceID: input.ManufacturerTradeLicenceID,
+		ManufacturerLocation:       input.ManufacturerLocation,
+		ManufacturerFoundingDate:   foundingDate,
+		SchemaVersion:              currentSchemaVersion(manufacturerObjectType),
+		Version:                    1,
+		DocType:                    manufacturerObjectType,
+	}
+	manufacturerAsBytes, err := json.Marshal(manufacturer)
+	if err != nil {
+		return "", err
+	}
+
+	err = putDocument(ctx, manufacturerKey, manufacturerAsBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return manufacturerKey, emitEvent(ctx, EventManufacturerAdded, &LedgerEvent{
+		Key:               manufacturerKey,
+		DocType:           manufacturerObjectType,
+		NewOwnerAccountID: input.ManufacturerAccountID,
+	})
+}
+
+// CreateFactory adds a factory to a manufacturer of the submitting identity and returns its key
+func (s *SmartContract) CreateFactory(ctx contractapi.TransactionContextInterface, input FactoryInput) (string, error) {
+	err := validationError(factoryValidations.check(input))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = requireManufacturerOwner(ctx, input.FactoryManufacturerID)
+	if err != nil {
+		return "", err
+	}
+
+	factoryKey, err := newDocumentKey(ctx, factoryObjectType)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireAbsent(ctx, "factory", factoryKey)
+	if err != nil {
+		return "", err
+	}
+
+	factory := Factory{
+		FactoryManufacturerID: input.FactoryManufacturerID,
+		FactoryID:             input.FactoryID,
+		FactoryName:           input.FactoryName,
+		FactoryLocation:       input.FactoryLocation,
+		SchemaVersion:         currentSchemaVersion(factoryObjectType),
+		Version:               1,
+		DocType:               factoryObjectType,
+	}
+	factoryAsBytes, err := json.Marshal(factory)
+	if err != nil {
+		return "", err
+	}
+
+	err = putDocument(ctx, factoryKey, factoryAsBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return factoryKey, emitEvent(ctx, EventFactoryAdded, &LedgerEvent{
+		Key:            factoryKey,
+		DocType:        factoryObjectType,
+		ManufacturerID: input.FactoryManufacturerID,
+	})
+}
+
+// CreateProduct adds a product made by a manufacturer of the submitting identity and returns its key.
+// The initial owner must be an account of the submitting identity too.
+func (s *SmartContract) CreateProduct(ctx contractapi.TransactionContextInterface, input ProductInput) (string, error) {
+	err := validationError(productValidations.check(input))
+	if err != nil {
+		return "", err
+	}
+
+	manufacturingDate, expiryDate, err := validateProductDates(ctx, input.ProductManufacturingDate, input.ProductExpiryDate)
+	if err != nil {
+		return "", err
+	}
+
+	manufacturer, err := requireManufacturerOwner(ctx, input.ProductManufacturerID)
+	if err != nil {
+		return "", err
+	}
+
+	// products may only be registered under the manufacturer's own name
+	manufacturerName := input.ProductManufacturerName
+	if manufacturerName == "" {
+		manufacturerName = manufacturer.ManufacturerName
+	} else if manufacturerName != manufacturer.ManufacturerName {
+		return "", ledgerErrorf(ErrValidationFailed, "the manufacturer name %s does not match manufacturer %s", manufacturerName, input.ProductManufacturerID)
+	}
+
+	err = requireFactoryOfManufacturer(ctx, input.ProductFactoryID, input.ProductManufacturerID)
+	if err != nil {
+		return "", err
+	}
+
+	// a new product starts with an account of the submitting identity; handing it to anyone else
+	// needs their consent through OfferProductTransfer
+	_, err = requireAccountOwner(ctx, input.ProductOwnerAccountID)
+	if err != nil {
+		return "", rephraseUnauthorized(err, "products can only be created for accounts of the submitting identity, not account %s", input.ProductOwnerAccountID)
+	}
+
+	productKey, err := newProductKey(ctx, input.ProductManufacturerID, input.ProductBatch, input.ProductSerialinBatch)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireAbsent(ctx, "product", productKey)
+	if err != nil {
+		return "", err
+	}
+
+	product := Product{
+		ProductOwnerAccountID:        input.ProductOwnerAccountID,
+		ProductManufacturerID:        input.ProductManufacturerID,
+		ProductManufacturerName:      manufacturerName,
+		ProductFactoryID:             input.ProductFactoryID,
+		ProductID:                    input.ProductID,
+		ProductName:                  input.ProductName,
+		ProductType:                  input.ProductType,
+		ProductBatch:                 input.ProductBatch,
+		ProductSerialinBatch:         input.ProductSerialinBatch,
+		ProductManufacturingLocation: input.ProductManufacturingLocation,
+		ProductManufacturingDate:     manufacturingDate,
+		ProductExpiryDate:            expiryDate,
+		DocType:                      productObjectType,
+	}
+
+	err = putProduct(ctx, productKey, &product)
+	if err != nil {
+		return "", err
+	}
+
+	return productKey, emitEvent(ctx, EventProductCreated, &LedgerEvent{
+		Key:               productKey,
+		DocType:           productObjectType,
+		ManufacturerID:    input.ProductManufacturerID,
+		FactoryID:         input.ProductFactoryID,
+		NewOwnerAccountID: input.ProductOwnerAccountID,
+	})
+}
+
+// UpdateManufacturerDetails replaces the details of a manufacturer of the submitting identity
+func (s *SmartContract) UpdateManufacturerDetails(ctx contractapi.TransactionContextInterface,
+	manufacturerKey string, details ManufacturerDetails, expectedVersion int) error {
+
+	err := validationError(manufacturerValidations.check(&details))
+	if err != nil {
+		return err
+	}
+
+	foundingDate, _, err := validatePastDate(ctx, "founding date", details.ManufacturerFoundingDate)
+	if err != nil {
+		return err
+	}
+
+	manufacturer, err := requireManufacturerOwner(ctx, manufacturerKey)
+	if err != nil {
+		return err
+	}
+
+	err = requireVersion("manufacturer", manufacturerKey, manufacturer.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	manufacturer.ManufacturerName = details.ManufacturerName
+	manufacturer.ManufacturerTradeLicenceID = details.ManufacturerTradeLicenceID
+	manufacturer.ManufacturerLocation = details.ManufacturerLocation
+	manufacturer.ManufacturerFoundingDate = foundingDate
+
+	manufacturer.SchemaVersion = currentSchemaVersion(manufacturerObjectType)
+	manufacturer.Version++
+	manufacturerAsBytes, err := json.Marshal(manufacturer)
+	if err != nil {
+		return err
+	}
+
+	err = putDocument(ctx, manufacturerKey, manufacturerAsBytes)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventManufacturerUpdated, &LedgerEvent{
+		Key:               manufacturerKey,
+		DocType:           manufacturer.DocType,
+		NewOwnerAccountID: manufacturer.ManufacturerAccountID,
+	})
+}
+
+// UpdateFactoryDetails replaces the details of a factory of a manufacturer of the submitting identity
+func (s *SmartContract) UpdateFactoryDetails(ctx contractapi.TransactionContextInterface,
+	factoryKey string, details FactoryDetails, expectedVersion int) error {
+
+	err := validationError(factoryValidations.check(&details))
+	if err != nil {
+		return err
+	}
+
+	factory, err := readFactory(ctx, factoryKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = requireManufacturerOwner(ctx, factory.FactoryManufacturerID)
+	if err != nil {
+		return err
+	}
+
+	err = requireVersion("factory", factoryKey, factory.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	// moving the factory to another manufacturer requires owning that one too, and is refused
+	// once products were made there since they would then point at another brand's factory
+	if details.FactoryManufacturerID != factory.FactoryManufacturerID {
+		_, err = requireManufacturerOwner(ctx, details.FactoryManufacturerID)
+		if err != nil {
+			return err
+		}
+
+		hasProducts, err := factoryHasProducts(ctx, factoryKey)
+		if err != nil {
+			return err
+		}
+		if hasProducts {
+			return ledgerErrorf(ErrConflict, "the factory %s has products and cannot move to manufacturer %s", factoryKey, details.FactoryManufacturerID)
+		}
+	}
+
+	factory.FactoryManufacturerID = details.FactoryManufacturerID
+	factory.FactoryName = details.FactoryName
+	factory.FactoryLocation = details.FactoryLocation
+
+	factory.SchemaVersion = currentSchemaVersion(factoryObjectType)
+	factory.Version++
+	factoryAsBytes, err := json.Marshal(factory)
+	if err != nil {
+		return err
+	}
+
+	err = putDocument(ctx, factoryKey, factoryAsBytes)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventFactoryUpdated, &LedgerEvent{
+		Key:            factoryKey,
+		DocType:        factory.DocType,
+		ManufacturerID: details.FactoryManufacturerID,
+	})
+}
+
+// UpdateProductDetails replaces the details of a product made by a manufacturer of the submitting identity
+func (s *SmartContract) UpdateProductDetails(ctx contractapi.TransactionContextInterface,
+	productKey string, details ProductDetails, expectedVersion int) error {
+
+	err := validationError(productValidations.check(&details))
+	if err != nil {
+		return err
+	}
+
+	manufacturingDate, expiryDate, err := validateProductDates(ctx, details.ProductManufacturingDate, details.ProductExpiryDate)
+	if err != nil {
+		return err
+	}
+
+	product, err := readProduct(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = requireManufacturerOwner(ctx, product.ProductManufacturerID)
+	if err != nil {
+		return err
+	}
+
+	err = requireVersion("product", productKey, product.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	// the batch and serial identify the physical item, so they are fixed once the product is created
+	var fieldErrors []FieldError
+	if details.ProductBatch != product.ProductBatch {
+		fieldErrors = append(fieldErrors, FieldError{Field: "ProductBatch", Message: "ProductBatch cannot be changed after creation"})
+	}
+	if details.ProductSerialinBatch != product.ProductSerialinBatch {
+		fieldErrors = append(fieldErrors, FieldError{Field: "ProductSerialinBatch", Message: "ProductSerialinBatch cannot be changed after creation"})
+	}
+	err = validationError(fieldErrors)
+	if err != nil {
+		return err
+	}
+
+	// the manufacturer may correct product details but not take ownership away from the current owner,
+	// nor hand the product to another identity without its consent
+	if details.ProductOwnerAccountID != product.ProductOwnerAccountID {
+		err = requireDirectTransfer(ctx, productKey, product, details.ProductOwnerAccountID)
+		if err != nil {
+			return err
+		}
+
+		err = deleteTransferOffer(ctx, productKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = requireFactoryOfManufacturer(ctx, details.ProductFactoryID, product.ProductManufacturerID)
+	if err != nil {
+		return err
+	}
+
+	previousOwnerAccountID := product.ProductOwnerAccountID
+	product.ProductOwnerAccountID = details.ProductOwnerAccountID
+	product.ProductFactoryID = details.ProductFactoryID
+	product.ProductName = details.ProductName
+	product.ProductType = details.ProductType
+	product.ProductManufacturingLocation = details.ProductManufacturingLocation
+	product.ProductManufacturingDate = manufacturingDate
+	product.ProductExpiryDate = expiryDate
+
+	err = putProduct(ctx, productKey, product)
+	if err != nil {
+		return err
+	}
+
+	// an update that changes hands is reported as a transfer so owners get notified
+	eventName := EventProductUpdated
+	if previousOwnerAccountID != details.ProductOwnerAccountID {
+		eventName = EventProductOwnerChanged
+	}
+
+	return emitEvent(ctx, eventName, &LedgerEvent{
+		Key:               productKey,
+		DocType:           product.DocType,
+		ManufacturerID:    product.ProductManufacturerID,
+		FactoryID:         details.ProductFactoryID,
+		OldOwnerAccountID: previousOwnerAccountID,
+		NewOwnerAccountID: details.ProductOwnerAccountID,
+	})
+}
@@ -0,0 +1,94 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/ledgertest"
+	"github.com/stretchr/testify/require"
+)
+
+// requireResponseErrorCode asserts that the chaincode response failed with the given error code
+func requireResponseErrorCode(t *testing.T, response peer.Response, code chaincode.ErrorCode) {
+	var ledgerError chaincode.LedgerError
+	require.NoError(t, json.Unmarshal([]byte(response.Message), &ledgerError), response.Message)
+	require.Equal(t, code, ledgerError.Code, ledgerError.Message)
+}
+
+func TestInputSchemas(t *testing.T) {
+	goodsLedgerChaincode, err := chaincode.NewChaincode()
+	require.NoError(t, err)
+
+	stub := ledgertest.NewStub()
+	stub.Args = [][]byte{[]byte("org.hyperledger.fabric:GetMetadata")}
+	response := goodsLedgerChaincode.Invoke(stub)
+	require.Equal(t, int32(200), response.Status, response.Message)
+
+	var metadata struct {
+		Components struct {
+			Schemas map[string]struct {
+				Required             []string               `json:"required"`
+				Properties           map[string]interface{} `json:"properties"`
+				AdditionalProperties bool                   `json:"additionalProperties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(response.Payload, &metadata))
+
+	productInput := metadata.Components.Schemas["ProductInput"]
+	require.ElementsMatch(t, []string{"ProductManufacturerID", "ProductID", "ProductOwnerAccountID", "ProductFactoryID",
+		"ProductName", "ProductType", "ProductBatch", "ProductSerialinBatch", "ProductManufacturingDate"}, productInput.Required)
+	require.Contains(t, productInput.Properties, "ProductExpiryDate")
+	require.NotContains(t, productInput.Properties, "DocType")
+	require.NotContains(t, productInput.Properties, "Version")
+	require.False(t, productInput.AdditionalProperties)
+
+	stub.Args = [][]byte{[]byte("CreateProduct"), []byte(`{"ProductManufacturerID":"manufacturer1","ProductID":"sku",` +
+		`"ProductOwnerAccountID":"account1","ProductFactoryID":"factory1","ProductName":"Soap","ProductType":"cosmetics",` +
+		`"ProductBatch":"batch1","ProductSerialinBatch":"1","ProductManufacturingDate":"2020-09-01","DocType":"account"}`)}
+	response = goodsLedgerChaincode.Invoke(stub)
+	requireResponseErrorCode(t, response, chaincode.ErrValidationFailed)
+
+	stub.Args = [][]byte{[]byte("CreateProduct"), []byte(`{"ProductManufacturerID":"manufacturer1"}`)}
+	response = goodsLedgerChaincode.Invoke(stub)
+	requireResponseErrorCode(t, response, chaincode.ErrValidationFailed)
+}
+
+func TestUpdateProductDetailsKeepsBatchAndSerial(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+		"product1": marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", ProductManufacturerID: "manufacturer1",
+			ProductFactoryID: "factory1", ProductBatch: "batch1", ProductSerialinBatch: "1", DocType: "product"}),
+	}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	goodsLedger := chaincode.SmartContract{}
+
+	details := chaincode.ProductDetails{
+		ProductOwnerAccountID:    "account1",
+		ProductFactoryID:         "factory1",
+		ProductName:              "Soap",
+		ProductType:              "cosmetics",
+		ProductBatch:             "batch2",
+		ProductSerialinBatch:     "2",
+		ProductManufacturingDate: "2020-09-01",
+	}
+	err := goodsLedger.UpdateProductDetails(transactionContext, "product1", details, 0)
+	requireFieldErrors(t, err, "ProductBatch", "ProductSerialinBatch")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	details.ProductBatch = "batch1"
+	details.ProductSerialinBatch = "1"
+	err = goodsLedger.UpdateProductDetails(transactionContext, "product1", details, 0)
+	require.NoError(t, err)
+
+	key, bytes := chaincodeStub.PutStateArgsForCall(0)
+	require.Equal(t, "product1", key)
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(bytes, &product))
+	require.Equal(t, "Soap", product.ProductName)
+	require.Equal(t, "batch1", product.ProductBatch)
+}
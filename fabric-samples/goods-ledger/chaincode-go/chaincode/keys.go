@@ -0,0 +1,66 @@
+package chaincode
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Composite key object types, one namespace per DocType
+const (
+	accountObjectType       = "account"
+	manufacturerObjectType  = "manufacturer"
+	factoryObjectType       = "factory"
+	productObjectType       = "product"
+	transferOfferObjectType = "transferOffer"
+	batchObjectType         = "batch"
+	recallObjectType        = "recall"
+)
+
+// Fabric rejects U+0000, which separates the parts of every composite key, inside composite key attributes.
+// Every attribute derived from a key or a client-supplied ID is escaped, since keys are composite keys
+// themselves and IDs may contain anything, using U+0001 as the escape character so that plain IDs stay unchanged.
+var (
+	keyAttributeEscaper   = strings.NewReplacer("\x01", "\x01\x01", "\x00", "\x01\x02")
+	keyAttributeUnescaper = strings.NewReplacer("\x01\x01", "\x01", "\x01\x02", "\x00")
+)
+
+// keyAttribute escapes a key for use as an attribute of another composite key
+func keyAttribute(key string) string {
+	return keyAttributeEscaper.Replace(key)
+}
+
+// keyFromAttribute recovers a key escaped by keyAttribute
+func keyFromAttribute(attribute string) string {
+	return keyAttributeUnescaper.Replace(attribute)
+}
+
+// createCompositeKey builds a composite key, reporting a failure of the stub as INTERNAL
+func createCompositeKey(ctx contractapi.TransactionContextInterface, objectType string, attributes []string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return "", ledgerErrorf(ErrInternal, "failed to create composite key: %v", err)
+	}
+
+	return key, nil
+}
+
+// newDocumentKey derives the key of a document created by the current transaction from its transaction ID
+func newDocumentKey(ctx contractapi.TransactionContextInterface, objectType string) (string, error) {
+	return createCompositeKey(ctx, objectType, []string{ctx.GetStub().GetTxID()})
+}
+
+// newProductKey derives the key of a product from its manufacturer, batch and serial within the batch
+func newProductKey(ctx contractapi.TransactionContextInterface, manufacturerKey string, batch string, serial string) (string, error) {
+	return createCompositeKey(ctx, productObjectType, []string{keyAttribute(manufacturerKey), keyAttribute(batch), keyAttribute(serial)})
+}
+
+// newBatchKey derives the key of a batch from its manufacturer and the manufacturer's batch ID
+func newBatchKey(ctx contractapi.TransactionContextInterface, manufacturerKey string, batchID string) (string, error) {
+	return createCompositeKey(ctx, batchObjectType, []string{keyAttribute(manufacturerKey), keyAttribute(batchID)})
+}
+
+// transferOfferKey returns the key of the pending transfer offer of a product; a product has at most one
+func transferOfferKey(ctx contractapi.TransactionContextInterface, productKey string) (string, error) {
+	return createCompositeKey(ctx, transferOfferObjectType, []string{keyAttribute(productKey)})
+}
@@ -0,0 +1,91 @@
+package chaincode_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/ledgertest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNestedKeysThroughShim builds every key that embeds another key or a client-supplied ID with the real
+// shim.CreateCompositeKey, which rejects U+0000 inside attributes, rather than with the mocked stub
+func TestNestedKeysThroughShim(t *testing.T) {
+	stub := ledgertest.NewStub()
+	alice := newScenarioContext(stub, "Org1MSP", "alice")
+	bob := newScenarioContext(stub, "Org2MSP", "bob")
+	goodsLedger := chaincode.SmartContract{}
+
+	aliceAccount := registerScenarioAccount(t, stub, alice, "tx-register-alice", "alice", "alice@example.com")
+	bobAccount := registerScenarioAccount(t, stub, bob, "tx-register-bob", "bob", "bob@example.com")
+
+	var manufacturerKey string
+	err := stub.Transact("tx-manufacturer", func() (err error) {
+		manufacturerKey, err = goodsLedger.AddManufacturer(alice, aliceAccount, "Acme", "licence1", "Dhaka", "2001-05-01", "manufacturer")
+		return err
+	})
+	require.NoError(t, err)
+
+	var factoryKey string
+	err = stub.Transact("tx-factory", func() (err error) {
+		factoryKey, err = goodsLedger.AddFactory(alice, manufacturerKey, "factory1", "Plant", "Dhaka", "factory")
+		return err
+	})
+	require.NoError(t, err)
+
+	// the batch ID is embedded in batch and product keys next to the manufacturer's own composite key
+	var batchKey string
+	err = stub.Transact("tx-batch", func() (err error) {
+		batchKey, err = goodsLedger.MintBatch(alice, manufacturerKey, factoryKey, "B\x001", "sku1", "Soap", "cosmetics",
+			"Dhaka", "2020-09-01", "2020-09-02", "2022-09-01", 2)
+		return err
+	})
+	require.NoError(t, err)
+
+	batch, err := goodsLedger.ReadBatch(alice, batchKey)
+	require.NoError(t, err)
+	require.Equal(t, manufacturerKey, batch.BatchManufacturerID)
+
+	var productKey string
+	err = stub.Transact("tx-product", func() (err error) {
+		productKey, err = goodsLedger.AddProduct(alice, aliceAccount, manufacturerKey, "Acme", factoryKey, "sku2", "Soap",
+			"cosmetics", "batch1", "1", "Dhaka", "2020-09-01", "2021-09-01", "product")
+		return err
+	})
+	require.NoError(t, err)
+
+	objectType, attributes, err := stub.SplitCompositeKey(productKey)
+	require.NoError(t, err)
+	require.Equal(t, "product", objectType)
+	require.Len(t, attributes, 3)
+
+	err = stub.Transact("tx-offer", func() error {
+		return goodsLedger.OfferProductTransfer(alice, productKey, bobAccount, "2020-09-20")
+	})
+	require.NoError(t, err)
+
+	offer, err := goodsLedger.ReadTransferOffer(bob, productKey)
+	require.NoError(t, err)
+	require.Equal(t, productKey, offer.ProductKey)
+
+	details, err := goodsLedger.ReadAccountDetails(alice, aliceAccount)
+	require.NoError(t, err)
+	require.Equal(t, "alice@example.com", details.AccountEmail)
+
+	products, err := goodsLedger.QueryProductbyManufacturerID(alice, manufacturerKey)
+	require.NoError(t, err)
+	require.Len(t, products, 3)
+
+	// every stored key is accepted by the shim's own key validation
+	for _, key := range stub.Keys() {
+		if !strings.HasPrefix(key, "\x00") {
+			continue
+		}
+		objectType, attributes, err := stub.SplitCompositeKey(key)
+		require.NoError(t, err)
+		_, err = shim.CreateCompositeKey(objectType, attributes)
+		require.NoError(t, err, "%q", key)
+	}
+}
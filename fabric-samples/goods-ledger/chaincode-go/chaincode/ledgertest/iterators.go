@@ -0,0 +1,71 @@
+package ledgertest
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// stateIterator iterates query results that were fully evaluated up front
+type stateIterator struct {
+	results []*queryresult.KV
+	next    int
+	closed  bool
+}
+
+func newStateIterator(results []*queryresult.KV) *stateIterator {
+	return &stateIterator{results: results}
+}
+
+// HasNext reports whether another result is left
+func (iterator *stateIterator) HasNext() bool {
+	return !iterator.closed && iterator.next < len(iterator.results)
+}
+
+// Next returns the next result
+func (iterator *stateIterator) Next() (*queryresult.KV, error) {
+	if !iterator.HasNext() {
+		return nil, fmt.Errorf("no more query results")
+	}
+	result := iterator.results[iterator.next]
+	iterator.next++
+
+	return result, nil
+}
+
+// Close ends the iteration
+func (iterator *stateIterator) Close() error {
+	iterator.closed = true
+
+	return nil
+}
+
+// historyIterator iterates the modifications of a key
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+	next          int
+	closed        bool
+}
+
+// HasNext reports whether another modification is left
+func (iterator *historyIterator) HasNext() bool {
+	return !iterator.closed && iterator.next < len(iterator.modifications)
+}
+
+// Next returns the next modification
+func (iterator *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !iterator.HasNext() {
+		return nil, fmt.Errorf("no more history records")
+	}
+	modification := iterator.modifications[iterator.next]
+	iterator.next++
+
+	return modification, nil
+}
+
+// Close ends the iteration
+func (iterator *historyIterator) Close() error {
+	iterator.closed = true
+
+	return nil
+}
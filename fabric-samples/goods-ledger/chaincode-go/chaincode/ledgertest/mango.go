@@ -0,0 +1,414 @@
+package ledgertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// mangoQuery is the part of a CouchDB query the evaluator understands; fields and use_index do not change
+// which documents match and are ignored
+type mangoQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []interface{}          `json:"sort"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+}
+
+// sortField is one field of the sort of a query
+type sortField struct {
+	path       string
+	descending bool
+}
+
+// document is a JSON document of the state together with its key
+type document struct {
+	kv    *queryresult.KV
+	value interface{}
+}
+
+// evaluateQuery returns the JSON documents of the state matching a CouchDB query, in the order of its sort
+// and otherwise by key. Values that are not JSON objects are never matched, as CouchDB stores them as attachments.
+func evaluateQuery(values map[string][]byte, query string) ([]*queryresult.KV, error) {
+	var parsed mangoQuery
+	err := json.Unmarshal([]byte(query), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %s: %v", query, err)
+	}
+	if parsed.Selector == nil {
+		return nil, fmt.Errorf("query %s has no selector", query)
+	}
+	sortFields, err := parseSort(parsed.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []document
+	for _, key := range sortedKeys(values) {
+		fields := map[string]interface{}{}
+		if json.Unmarshal(values[key], &fields) != nil {
+			continue
+		}
+		fields["_id"] = key
+
+		matched, err := matchSelector(fields, parsed.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			documents = append(documents, document{kv: &queryresult.KV{Key: key, Value: values[key]}, value: fields})
+		}
+	}
+
+	sort.SliceStable(documents, func(i, j int) bool {
+		for _, field := range sortFields {
+			left, _ := lookup(documents[i].value, field.path)
+			right, _ := lookup(documents[j].value, field.path)
+			order := collate(left, right)
+			if order != 0 {
+				return (order < 0) != field.descending
+			}
+		}
+		return false
+	})
+
+	if parsed.Skip > len(documents) {
+		parsed.Skip = len(documents)
+	}
+	documents = documents[parsed.Skip:]
+	if parsed.Limit > 0 && parsed.Limit < len(documents) {
+		documents = documents[:parsed.Limit]
+	}
+
+	results := make([]*queryresult.KV, 0, len(documents))
+	for _, matched := range documents {
+		results = append(results, matched.kv)
+	}
+
+	return results, nil
+}
+
+// parseSort parses a sort given as field names or {"field": "asc|desc"} objects
+func parseSort(fields []interface{}) ([]sortField, error) {
+	var sortFields []sortField
+	for _, field := range fields {
+		switch field := field.(type) {
+		case string:
+			sortFields = append(sortFields, sortField{path: field})
+		case map[string]interface{}:
+			for path, direction := range field {
+				if direction != "asc" && direction != "desc" {
+					return nil, fmt.Errorf("invalid sort direction %v for field %s", direction, path)
+				}
+				sortFields = append(sortFields, sortField{path: path, descending: direction == "desc"})
+			}
+		default:
+			return nil, fmt.Errorf("invalid sort field %v", field)
+		}
+	}
+
+	return sortFields, nil
+}
+
+// matchSelector reports whether a document matches every condition of the selector
+func matchSelector(value interface{}, selector map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		var matched bool
+		var err error
+		switch field {
+		case "$and", "$or", "$nor":
+			matched, err = matchCombination(value, field, condition)
+		case "$not":
+			subSelector, ok := condition.(map[string]interface{})
+			if !ok {
+				return false, fmt.Errorf("$not takes a selector, not %v", condition)
+			}
+			matched, err = matchSelector(value, subSelector)
+			matched = !matched
+		default:
+			if strings.HasPrefix(field, "$") {
+				return false, fmt.Errorf("unsupported combination operator %s", field)
+			}
+			fieldValue, exists := lookup(value, field)
+			matched, err = matchCondition(fieldValue, exists, condition)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// matchCombination evaluates $and, $or and $nor over a list of selectors
+func matchCombination(value interface{}, operator string, condition interface{}) (bool, error) {
+	selectors, ok := condition.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("%s takes a list of selectors, not %v", operator, condition)
+	}
+
+	matches := 0
+	for _, selector := range selectors {
+		subSelector, ok := selector.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s takes a list of selectors, not %v", operator, condition)
+		}
+		matched, err := matchSelector(value, subSelector)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			matches++
+		}
+	}
+
+	switch operator {
+	case "$and":
+		return matches == len(selectors), nil
+	case "$or":
+		return matches > 0, nil
+	default:
+		return matches == 0, nil
+	}
+}
+
+// matchCondition reports whether a field value matches a condition: an object of operators, a nested
+// selector or, for anything else, an implicit $eq
+func matchCondition(value interface{}, exists bool, condition interface{}) (bool, error) {
+	operators, ok := condition.(map[string]interface{})
+	if !ok || !hasOperators(operators) {
+		if ok && len(operators) > 0 {
+			if !exists {
+				return false, nil
+			}
+			return matchSelector(value, operators)
+		}
+		return exists && collate(value, condition) == 0, nil
+	}
+
+	for operator, operand := range operators {
+		matched, err := matchOperator(value, exists, operator, operand)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// hasOperators reports whether the keys of a condition are operators rather than field names
+func hasOperators(condition map[string]interface{}) bool {
+	for key := range condition {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOperator evaluates one condition operator. Only $exists matches fields that are missing.
+func matchOperator(value interface{}, exists bool, operator string, operand interface{}) (bool, error) {
+	if operator == "$exists" {
+		want, ok := operand.(bool)
+		if !ok {
+			return false, fmt.Errorf("$exists takes a boolean, not %v", operand)
+		}
+		return exists == want, nil
+	}
+
+	switch operator {
+	case "$eq":
+		return exists && collate(value, operand) == 0, nil
+	case "$ne":
+		return exists && collate(value, operand) != 0, nil
+	case "$gt":
+		return exists && collate(value, operand) > 0, nil
+	case "$gte":
+		return exists && collate(value, operand) >= 0, nil
+	case "$lt":
+		return exists && collate(value, operand) < 0, nil
+	case "$lte":
+		return exists && collate(value, operand) <= 0, nil
+	case "$in", "$nin":
+		candidates, ok := operand.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s takes a list, not %v", operator, operand)
+		}
+		if !exists {
+			return false, nil
+		}
+		found := false
+		for _, candidate := range candidates {
+			if collate(value, candidate) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "$in"), nil
+	case "$regex":
+		pattern, ok := operand.(string)
+		if !ok {
+			return false, fmt.Errorf("$regex takes a string, not %v", operand)
+		}
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid $regex %q: %v", pattern, err)
+		}
+		text, ok := value.(string)
+		return exists && ok && expression.MatchString(text), nil
+	case "$type":
+		return exists && typeName(value) == operand, nil
+	case "$size":
+		size, ok := operand.(float64)
+		if !ok {
+			return false, fmt.Errorf("$size takes a number, not %v", operand)
+		}
+		elements, ok := value.([]interface{})
+		return exists && ok && float64(len(elements)) == size, nil
+	case "$all":
+		wanted, ok := operand.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("$all takes a list, not %v", operand)
+		}
+		elements, ok := value.([]interface{})
+		if !exists || !ok {
+			return false, nil
+		}
+		for _, want := range wanted {
+			if !containsValue(elements, want) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$elemMatch":
+		elements, ok := value.([]interface{})
+		if !exists || !ok {
+			return false, nil
+		}
+		for _, element := range elements {
+			matched, err := matchCondition(element, true, operand)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	case "$not":
+		matched, err := matchCondition(value, exists, operand)
+		return exists && !matched, err
+	default:
+		return false, fmt.Errorf("unsupported condition operator %s", operator)
+	}
+}
+
+// lookup returns the value at a dotted field path of a document
+func lookup(value interface{}, path string) (interface{}, bool) {
+	for _, field := range strings.Split(path, ".") {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = fields[field]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// containsValue reports whether a list holds a value
+func containsValue(elements []interface{}, want interface{}) bool {
+	for _, element := range elements {
+		if collate(element, want) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeName returns the CouchDB $type name of a JSON value
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// typeRank orders JSON types the way CouchDB collates them
+func typeRank(value interface{}) int {
+	switch value := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		if value {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// collate compares two JSON values in CouchDB order: null, false, true, numbers, strings, arrays, objects.
+// Strings compare by byte order rather than by CouchDB's ICU collation.
+func collate(left interface{}, right interface{}) int {
+	leftRank, rightRank := typeRank(left), typeRank(right)
+	if leftRank != rightRank {
+		if leftRank < rightRank {
+			return -1
+		}
+		return 1
+	}
+
+	switch left := left.(type) {
+	case float64:
+		right := right.(float64)
+		if left < right {
+			return -1
+		}
+		if left > right {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(left, right.(string))
+	case []interface{}:
+		right := right.([]interface{})
+		for i := 0; i < len(left) && i < len(right); i++ {
+			order := collate(left[i], right[i])
+			if order != 0 {
+				return order
+			}
+		}
+		return len(left) - len(right)
+	case map[string]interface{}:
+		leftBytes, _ := json.Marshal(left)
+		rightBytes, _ := json.Marshal(right)
+		return bytes.Compare(leftBytes, rightBytes)
+	default:
+		return 0
+	}
+}
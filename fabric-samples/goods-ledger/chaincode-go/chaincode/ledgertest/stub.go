@@ -0,0 +1,536 @@
+// Package ledgertest provides an in-memory implementation of shim.ChaincodeStubInterface, so contract
+// functions can be exercised end to end against a real world state without a Fabric network.
+package ledgertest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// compositeKeyNamespace starts every composite key; simple key range queries never return composite keys
+const compositeKeyNamespace = "\x00"
+
+// write is a pending write of the current transaction
+type write struct {
+	value    []byte
+	isDelete bool
+}
+
+// Stub is an in-memory shim.ChaincodeStubInterface. Like a peer, it only shows committed state to reads:
+// writes of the transaction in progress become visible once Transact commits them. Rich queries are
+// evaluated with a Mango selector evaluator that compares strings by byte order, where CouchDB uses
+// ICU collation.
+type Stub struct {
+	// ChannelID is returned by GetChannelID
+	ChannelID string
+	// TxTimestamp is the timestamp of the transactions committed by Transact
+	TxTimestamp time.Time
+	// Creator is returned by GetCreator
+	Creator []byte
+	// Transient is the transient data of the next transaction; Transact clears it
+	Transient map[string][]byte
+	// Args are the arguments returned by GetArgs and the functions derived from it
+	Args [][]byte
+
+	txID                 string
+	state                map[string][]byte
+	writes               map[string]write
+	history              map[string][]*queryresult.KeyModification
+	private              map[string]map[string][]byte
+	privateWrites        map[string]map[string]write
+	validationParameters map[string][]byte
+	event                *peer.ChaincodeEvent
+	events               []*peer.ChaincodeEvent
+}
+
+// NewStub returns an empty stub whose transactions are timestamped 2020-09-13T12:26:40Z
+func NewStub() *Stub {
+	return &Stub{
+		ChannelID:            "mychannel",
+		TxTimestamp:          time.Unix(1600000000, 0).UTC(),
+		state:                map[string][]byte{},
+		writes:               map[string]write{},
+		history:              map[string][]*queryresult.KeyModification{},
+		private:              map[string]map[string][]byte{},
+		privateWrites:        map[string]map[string]write{},
+		validationParameters: map[string][]byte{},
+	}
+}
+
+// Transact runs one transaction with the given ID. Its writes and event are committed when transaction
+// returns nil and discarded otherwise, as the peer would for a failed endorsement.
+func (stub *Stub) Transact(txID string, transaction func() error) error {
+	stub.txID = txID
+	stub.writes = map[string]write{}
+	stub.privateWrites = map[string]map[string]write{}
+	stub.event = nil
+	defer func() {
+		stub.Transient = nil
+	}()
+
+	err := transaction()
+	if err != nil {
+		return err
+	}
+
+	txTimestamp, err := ptypes.TimestampProto(stub.TxTimestamp)
+	if err != nil {
+		return err
+	}
+
+	for key, pending := range stub.writes {
+		if pending.isDelete {
+			delete(stub.state, key)
+		} else {
+			stub.state[key] = pending.value
+		}
+		stub.history[key] = append(stub.history[key], &queryresult.KeyModification{
+			TxId:      txID,
+			Value:     pending.value,
+			Timestamp: txTimestamp,
+			IsDelete:  pending.isDelete,
+		})
+	}
+	for collection, writes := range stub.privateWrites {
+		if stub.private[collection] == nil {
+			stub.private[collection] = map[string][]byte{}
+		}
+		for key, pending := range writes {
+			if pending.isDelete {
+				delete(stub.private[collection], key)
+			} else {
+				stub.private[collection][key] = pending.value
+			}
+		}
+	}
+	if stub.event != nil {
+		stub.events = append(stub.events, stub.event)
+	}
+
+	return nil
+}
+
+// Seed commits a value to the world state outside of any transaction
+func (stub *Stub) Seed(key string, value []byte) {
+	stub.state[key] = value
+}
+
+// SeedPrivateData commits a value to a private data collection outside of any transaction
+func (stub *Stub) SeedPrivateData(collection string, key string, value []byte) {
+	if stub.private[collection] == nil {
+		stub.private[collection] = map[string][]byte{}
+	}
+	stub.private[collection][key] = value
+}
+
+// Keys returns the committed world state keys in order, composite keys included
+func (stub *Stub) Keys() []string {
+	return sortedKeys(stub.state)
+}
+
+// Events returns the events of the committed transactions, oldest first
+func (stub *Stub) Events() []*peer.ChaincodeEvent {
+	return stub.events
+}
+
+// GetArgs returns the Args of the stub
+func (stub *Stub) GetArgs() [][]byte {
+	return stub.Args
+}
+
+// GetStringArgs returns the Args of the stub as strings
+func (stub *Stub) GetStringArgs() []string {
+	args := make([]string, 0, len(stub.Args))
+	for _, arg := range stub.Args {
+		args = append(args, string(arg))
+	}
+
+	return args
+}
+
+// GetFunctionAndParameters returns the first argument as the function name and the rest as its parameters
+func (stub *Stub) GetFunctionAndParameters() (string, []string) {
+	args := stub.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+
+	return args[0], args[1:]
+}
+
+// GetArgsSlice returns the Args of the stub concatenated
+func (stub *Stub) GetArgsSlice() ([]byte, error) {
+	var argsSlice []byte
+	for _, arg := range stub.Args {
+		argsSlice = append(argsSlice, arg...)
+	}
+
+	return argsSlice, nil
+}
+
+// GetTxID returns the ID of the transaction in progress
+func (stub *Stub) GetTxID() string {
+	return stub.txID
+}
+
+// GetChannelID returns the ChannelID of the stub
+func (stub *Stub) GetChannelID() string {
+	return stub.ChannelID
+}
+
+// InvokeChaincode is not supported; it always returns an error response
+func (stub *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	return shim.Error(fmt.Sprintf("the in-memory stub cannot invoke chaincode %s", chaincodeName))
+}
+
+// GetState returns the committed value of the key, or nil when it does not exist
+func (stub *Stub) GetState(key string) ([]byte, error) {
+	return stub.state[key], nil
+}
+
+// PutState records a write of the transaction in progress
+func (stub *Stub) PutState(key string, value []byte) error {
+	err := validateKey(key)
+	if err != nil {
+		return err
+	}
+	stub.writes[key] = write{value: value}
+
+	return nil
+}
+
+// DelState records a delete of the transaction in progress
+func (stub *Stub) DelState(key string) error {
+	err := validateKey(key)
+	if err != nil {
+		return err
+	}
+	stub.writes[key] = write{isDelete: true}
+
+	return nil
+}
+
+// SetStateValidationParameter stores the key-level endorsement policy of the key
+func (stub *Stub) SetStateValidationParameter(key string, ep []byte) error {
+	stub.validationParameters[key] = ep
+
+	return nil
+}
+
+// GetStateValidationParameter returns the key-level endorsement policy of the key
+func (stub *Stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return stub.validationParameters[key], nil
+}
+
+// GetStateByRange iterates the committed simple keys from startKey up to but excluding endKey
+func (stub *Stub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = "\x01"
+	}
+
+	return newStateIterator(rangeOf(stub.state, startKey, endKey)), nil
+}
+
+// GetStateByRangeWithPagination returns one page of GetStateByRange. The bookmark is the next key.
+func (stub *Stub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	if startKey == "" {
+		startKey = "\x01"
+	}
+
+	return pageOfRange(rangeOf(stub.state, startKey, endKey), pageSize)
+}
+
+// GetStateByPartialCompositeKey iterates the committed composite keys that start with the given attributes
+func (stub *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStateIterator(rangeOf(stub.state, prefix, prefix+string(utf8.MaxRune))), nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns one page of GetStateByPartialCompositeKey.
+// The bookmark is the next key.
+func (stub *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+
+	prefix, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startKey := prefix
+	if bookmark != "" {
+		startKey = bookmark
+	}
+
+	return pageOfRange(rangeOf(stub.state, startKey, prefix+string(utf8.MaxRune)), pageSize)
+}
+
+// CreateCompositeKey combines the object type and attributes into a composite key
+func (stub *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey splits a composite key into its object type and attributes
+func (stub *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) || !strings.HasSuffix(compositeKey, "\x00") {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+	components := strings.Split(compositeKey[1:len(compositeKey)-1], "\x00")
+
+	return components[0], components[1:], nil
+}
+
+// GetQueryResult evaluates a CouchDB query against the committed JSON documents of the world state
+func (stub *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	results, err := evaluateQuery(stub.state, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStateIterator(results), nil
+}
+
+// GetQueryResultWithPagination returns one page of GetQueryResult. The bookmark is the offset of the next result.
+func (stub *Stub) GetQueryResultWithPagination(query string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+
+	results, err := evaluateQuery(stub.state, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	offset := 0
+	if bookmark != "" {
+		offset, err = strconv.Atoi(bookmark)
+		if err != nil || offset < 0 {
+			return nil, nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+	}
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+
+	nextBookmark := ""
+	if pageSize > 0 && int(pageSize) < len(results) {
+		results = results[:pageSize]
+		nextBookmark = strconv.Itoa(offset + int(pageSize))
+	}
+
+	return newStateIterator(results), &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(results)),
+		Bookmark:            nextBookmark,
+	}, nil
+}
+
+// GetHistoryForKey iterates the committed modifications of the key, newest first as on Fabric v2
+func (stub *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	modifications := stub.history[key]
+	newestFirst := make([]*queryresult.KeyModification, 0, len(modifications))
+	for i := len(modifications) - 1; i >= 0; i-- {
+		newestFirst = append(newestFirst, modifications[i])
+	}
+
+	return &historyIterator{modifications: newestFirst}, nil
+}
+
+// GetPrivateData returns the committed value of the key in the collection, or nil when it does not exist
+func (stub *Stub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return stub.private[collection][key], nil
+}
+
+// GetPrivateDataHash returns the SHA-256 hash of the committed value of the key in the collection
+func (stub *Stub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value, ok := stub.private[collection][key]
+	if !ok {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+
+	return hash[:], nil
+}
+
+// PutPrivateData records a private data write of the transaction in progress
+func (stub *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	err := validateKey(key)
+	if err != nil {
+		return err
+	}
+	stub.privateWrite(collection)[key] = write{value: value}
+
+	return nil
+}
+
+// DelPrivateData records a private data delete of the transaction in progress
+func (stub *Stub) DelPrivateData(collection string, key string) error {
+	err := validateKey(key)
+	if err != nil {
+		return err
+	}
+	stub.privateWrite(collection)[key] = write{isDelete: true}
+
+	return nil
+}
+
+// SetPrivateDataValidationParameter stores the key-level endorsement policy of the private key
+func (stub *Stub) SetPrivateDataValidationParameter(collection string, key string, ep []byte) error {
+	stub.validationParameters[collection+"\x00"+key] = ep
+
+	return nil
+}
+
+// GetPrivateDataValidationParameter returns the key-level endorsement policy of the private key
+func (stub *Stub) GetPrivateDataValidationParameter(collection string, key string) ([]byte, error) {
+	return stub.validationParameters[collection+"\x00"+key], nil
+}
+
+// GetPrivateDataByRange iterates the committed simple keys of the collection from startKey up to but excluding endKey
+func (stub *Stub) GetPrivateDataByRange(collection string, startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = "\x01"
+	}
+
+	return newStateIterator(rangeOf(stub.private[collection], startKey, endKey)), nil
+}
+
+// GetPrivateDataByPartialCompositeKey iterates the committed composite keys of the collection that start
+// with the given attributes
+func (stub *Stub) GetPrivateDataByPartialCompositeKey(collection string, objectType string,
+	keys []string) (shim.StateQueryIteratorInterface, error) {
+
+	prefix, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStateIterator(rangeOf(stub.private[collection], prefix, prefix+string(utf8.MaxRune))), nil
+}
+
+// GetPrivateDataQueryResult evaluates a CouchDB query against the committed JSON documents of the collection
+func (stub *Stub) GetPrivateDataQueryResult(collection string, query string) (shim.StateQueryIteratorInterface, error) {
+	results, err := evaluateQuery(stub.private[collection], query)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStateIterator(results), nil
+}
+
+// GetCreator returns the Creator of the stub
+func (stub *Stub) GetCreator() ([]byte, error) {
+	return stub.Creator, nil
+}
+
+// GetTransient returns the Transient data of the stub
+func (stub *Stub) GetTransient() (map[string][]byte, error) {
+	return stub.Transient, nil
+}
+
+// GetBinding returns nil; the stub has no proposal to bind to
+func (stub *Stub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+// GetDecorations returns nil; the stub has no proposal decorations
+func (stub *Stub) GetDecorations() map[string][]byte {
+	return nil
+}
+
+// GetSignedProposal is not supported; the stub has no signed proposal
+func (stub *Stub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return nil, fmt.Errorf("the in-memory stub has no signed proposal")
+}
+
+// GetTxTimestamp returns the TxTimestamp of the stub
+func (stub *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return ptypes.TimestampProto(stub.TxTimestamp)
+}
+
+// SetEvent sets the event of the transaction in progress, replacing any earlier one as the peer does
+func (stub *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	stub.event = &peer.ChaincodeEvent{TxId: stub.txID, EventName: name, Payload: payload}
+
+	return nil
+}
+
+// privateWrite returns the pending writes of the collection
+func (stub *Stub) privateWrite(collection string) map[string]write {
+	if stub.privateWrites[collection] == nil {
+		stub.privateWrites[collection] = map[string]write{}
+	}
+
+	return stub.privateWrites[collection]
+}
+
+// validateKey rejects the keys a peer rejects
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("key %q is not valid UTF-8", key)
+	}
+
+	return nil
+}
+
+// sortedKeys returns the keys of the values in order
+func sortedKeys(values map[string][]byte) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// rangeOf returns the values with keys from startKey up to but excluding endKey, in key order.
+// An empty endKey leaves the range open.
+func rangeOf(values map[string][]byte, startKey string, endKey string) []*queryresult.KV {
+	var results []*queryresult.KV
+	for _, key := range sortedKeys(values) {
+		if key < startKey || (endKey != "" && key >= endKey) {
+			continue
+		}
+		results = append(results, &queryresult.KV{Key: key, Value: values[key]})
+	}
+
+	return results
+}
+
+// pageOfRange cuts a page off a key range, bookmarking the first key of the next page
+func pageOfRange(results []*queryresult.KV, pageSize int32) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	bookmark := ""
+	if pageSize > 0 && int(pageSize) < len(results) {
+		bookmark = results[pageSize].Key
+		results = results[:pageSize]
+	}
+
+	return newStateIterator(results), &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(results)),
+		Bookmark:            bookmark,
+	}, nil
+}
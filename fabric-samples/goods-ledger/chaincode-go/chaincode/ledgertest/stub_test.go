@@ -0,0 +1,137 @@
+package ledgertest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/ledgertest"
+	"github.com/stretchr/testify/require"
+)
+
+func keysOf(t *testing.T, iterator shim.StateQueryIteratorInterface) []string {
+	defer iterator.Close()
+
+	var keys []string
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+		require.NoError(t, err)
+		keys = append(keys, result.Key)
+	}
+
+	return keys
+}
+
+func TestTransact(t *testing.T) {
+	stub := ledgertest.NewStub()
+
+	err := stub.Transact("tx1", func() error {
+		require.NoError(t, stub.PutState("a", []byte("1")))
+		value, err := stub.GetState("a")
+		require.NoError(t, err)
+		require.Nil(t, value)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = stub.Transact("tx2", func() error {
+		require.NoError(t, stub.DelState("a"))
+		return fmt.Errorf("endorsement failed")
+	})
+	require.EqualError(t, err, "endorsement failed")
+
+	value, err := stub.GetState("a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), value)
+
+	err = stub.Transact("tx3", func() error {
+		return stub.DelState("a")
+	})
+	require.NoError(t, err)
+
+	history, err := stub.GetHistoryForKey("a")
+	require.NoError(t, err)
+	modification, err := history.Next()
+	require.NoError(t, err)
+	require.Equal(t, "tx3", modification.TxId)
+	require.True(t, modification.IsDelete)
+	modification, err = history.Next()
+	require.NoError(t, err)
+	require.Equal(t, "tx1", modification.TxId)
+	require.False(t, history.HasNext())
+}
+
+func TestRangeAndCompositeKeyQueries(t *testing.T) {
+	stub := ledgertest.NewStub()
+	stub.Seed("a", []byte("1"))
+	stub.Seed("b", []byte("2"))
+	stub.Seed("c", []byte("3"))
+	for _, attributes := range [][]string{{"red", "1"}, {"red", "2"}, {"blue", "1"}} {
+		key, err := stub.CreateCompositeKey("color", attributes)
+		require.NoError(t, err)
+		stub.Seed(key, []byte{0x00})
+	}
+
+	iterator, err := stub.GetStateByRange("", "c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, keysOf(t, iterator))
+
+	iterator, metadata, err := stub.GetStateByRangeWithPagination("", "", 2, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, keysOf(t, iterator))
+	require.Equal(t, "c", metadata.Bookmark)
+
+	iterator, err = stub.GetStateByPartialCompositeKey("color", []string{"red"})
+	require.NoError(t, err)
+	keys := keysOf(t, iterator)
+	require.Len(t, keys, 2)
+
+	objectType, attributes, err := stub.SplitCompositeKey(keys[1])
+	require.NoError(t, err)
+	require.Equal(t, "color", objectType)
+	require.Equal(t, []string{"red", "2"}, attributes)
+}
+
+func TestGetQueryResult(t *testing.T) {
+	stub := ledgertest.NewStub()
+	stub.Seed("p1", []byte(`{"DocType":"product","Name":"Soap","Price":3,"Tags":["bath"]}`))
+	stub.Seed("p2", []byte(`{"DocType":"product","Name":"Shampoo","Price":7,"Tags":["bath","hair"]}`))
+	stub.Seed("p3", []byte(`{"DocType":"product","Name":"Rice","Price":5,"Origin":{"Country":"BD"}}`))
+	stub.Seed("m1", []byte(`{"DocType":"manufacturer","Name":"Acme"}`))
+	stub.Seed("index", []byte{0x00})
+
+	tests := []struct {
+		query string
+		keys  []string
+	}{
+		{`{"selector":{"DocType":"product"}}`, []string{"p1", "p2", "p3"}},
+		{`{"selector":{"DocType":"product","Price":{"$gt":3,"$lte":7}}}`, []string{"p2", "p3"}},
+		{`{"selector":{"Name":{"$in":["Soap","Acme"]}}}`, []string{"m1", "p1"}},
+		{`{"selector":{"DocType":"product","Name":{"$regex":"^S"}}}`, []string{"p1", "p2"}},
+		{`{"selector":{"Origin.Country":"BD"}}`, []string{"p3"}},
+		{`{"selector":{"Origin":{"Country":"BD"}}}`, []string{"p3"}},
+		{`{"selector":{"DocType":"product","Origin":{"$exists":false}}}`, []string{"p1", "p2"}},
+		{`{"selector":{"Tags":{"$elemMatch":{"$eq":"hair"}}}}`, []string{"p2"}},
+		{`{"selector":{"$or":[{"Price":3},{"DocType":"manufacturer"}]}}`, []string{"m1", "p1"}},
+		{`{"selector":{"DocType":"product","$not":{"Price":5}}}`, []string{"p1", "p2"}},
+		{`{"selector":{"_id":{"$gt":"p1"}}}`, []string{"p2", "p3"}},
+		{`{"selector":{"DocType":"product","Price":{"$gt":null}},"sort":[{"Price":"desc"}]}`, []string{"p2", "p3", "p1"}},
+		{`{"selector":{"DocType":"product"},"sort":["Name"],"skip":1,"limit":1}`, []string{"p2"}},
+	}
+	for _, test := range tests {
+		iterator, err := stub.GetQueryResult(test.query)
+		require.NoError(t, err, test.query)
+		require.Equal(t, test.keys, keysOf(t, iterator), test.query)
+	}
+
+	iterator, metadata, err := stub.GetQueryResultWithPagination(`{"selector":{"DocType":"product"}}`, 2, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"p1", "p2"}, keysOf(t, iterator))
+	iterator, metadata, err = stub.GetQueryResultWithPagination(`{"selector":{"DocType":"product"}}`, 2, metadata.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []string{"p3"}, keysOf(t, iterator))
+	require.Empty(t, metadata.Bookmark)
+
+	_, err = stub.GetQueryResult(`{"selector":{"Price":{"$near":3}}}`)
+	require.EqualError(t, err, "unsupported condition operator $near")
+}
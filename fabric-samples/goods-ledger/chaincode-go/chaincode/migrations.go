@@ -0,0 +1,209 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// migrationStep upgrades a raw stored document by one schema version. Steps work on the decoded JSON
+// rather than the current struct, so they can still see fields that a later schema dropped or renamed.
+type migrationStep func(document map[string]interface{})
+
+// migrations lists the upgrade steps of each DocType; step i upgrades a document from schema version i
+// to i+1, so the current schema version of a DocType is the number of its steps. Documents written
+// before schema versions existed are at version 0. To evolve a document, append a step here.
+var migrations = map[string][]migrationStep{
+	// private account fields left in world state are moved by ScrubAccounts, not by migration
+	accountObjectType:       {stampSchemaVersion, addIndexEntries},
+	manufacturerObjectType:  {normalizeDateFields(normalizeLedgerDate, "ManufacturerFoundingDate"), addIndexEntries},
+	factoryObjectType:       {stampSchemaVersion, addIndexEntries},
+	productObjectType:       {normalizeProductDates, addIndexEntries},
+	transferOfferObjectType: {stampSchemaVersion},
+	batchObjectType:         {stampSchemaVersion, addIndexEntries},
+	recallObjectType:        {stampSchemaVersion, addIndexEntries},
+}
+
+// currentSchemaVersion returns the schema version that documents of the given DocType are written with
+func currentSchemaVersion(docType string) int {
+	return len(migrations[docType])
+}
+
+// stampSchemaVersion is the step for schema versions that only add the SchemaVersion field itself
+func stampSchemaVersion(document map[string]interface{}) {}
+
+// addIndexEntries is the step for the schema version that added composite key index entries. The document
+// itself is unchanged; putDocument writes its entries when the migrated document is put.
+func addIndexEntries(document map[string]interface{}) {}
+
+// normalizeDateFields returns a step that rewrites the given date fields with normalize, leaving
+// free-form dates from before date validation untouched rather than losing them
+func normalizeDateFields(normalize func(string) (string, time.Time, error), fields ...string) migrationStep {
+	return func(document map[string]interface{}) {
+		for _, field := range fields {
+			value, ok := document[field].(string)
+			if !ok || value == "" {
+				continue
+			}
+			normalized, _, err := normalize(value)
+			if err == nil {
+				document[field] = normalized
+			}
+		}
+	}
+}
+
+// normalizeProductDates is the step for the schema version that normalized product dates. Expiry dates
+// without a time of day keep the product valid through that day, as they do for new products.
+func normalizeProductDates(document map[string]interface{}) {
+	normalizeDateFields(normalizeLedgerDate, "ProductManufacturingDate")(document)
+	normalizeDateFields(normalizeExpiryDate, "ProductExpiryDate")(document)
+}
+
+// upgradeDocument applies the pending migration steps to a stored document and reports whether it
+// changed. Documents of DocTypes without migrations, and documents already current, are returned as is.
+func upgradeDocument(documentAsBytes []byte) ([]byte, bool, error) {
+	var header struct {
+		DocType       string `json:"DocType"`
+		SchemaVersion int    `json:"SchemaVersion"`
+	}
+	err := json.Unmarshal(documentAsBytes, &header)
+	if err != nil {
+		return nil, false, err
+	}
+
+	steps := migrations[header.DocType]
+	if header.SchemaVersion >= len(steps) {
+		return documentAsBytes, false, nil
+	}
+
+	var document map[string]interface{}
+	err = json.Unmarshal(documentAsBytes, &document)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, step := range steps[header.SchemaVersion:] {
+		step(document)
+	}
+	document["SchemaVersion"] = len(steps)
+
+	upgradedAsBytes, err := json.Marshal(document)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return upgradedAsBytes, true, nil
+}
+
+// MigrationResult reports one page of MigrateDocuments. Bookmark is empty once no documents are left.
+type MigrationResult struct {
+	MigratedKeys  []string `json:"migratedKeys"`
+	MigratedCount int32    `json:"migratedCount"`
+	Bookmark      string   `json:"bookmark"`
+}
+
+// MigrateDocuments upgrades up to pageSize documents of the given DocType stored at fromVersion to the
+// current schema version. Documents are visited in key order after bookmark; pass the returned bookmark
+// to the next call to resume. Reads upgrade documents on the fly, so migration only needs to finish
+// before queries rely on the new schema. Only goods-ledger administrators may migrate documents.
+func (s *SmartContract) MigrateDocuments(ctx contractapi.TransactionContextInterface,
+	docType string, fromVersion int, pageSize int32, bookmark string) (*MigrationResult, error) {
+
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, ok := migrations[docType]
+	if !ok {
+		return nil, ledgerErrorf(ErrValidationFailed, "documents of type %s cannot be migrated", docType)
+	}
+	if fromVersion < 0 || fromVersion >= len(steps) {
+		return nil, ledgerErrorf(ErrValidationFailed, "the schema version of %s documents must be between 0 and %d", docType, len(steps)-1)
+	}
+
+	// paginated queries are only supported in read-only transactions, so the page is cut here
+	// and the bookmark is the last key migrated. CouchDB does not promise any order without a sort,
+	// so documents are sorted by key to make sure none before the bookmark is skipped.
+	query := newSelector(docType).greaterThan("_id", bookmark)
+	if fromVersion == 0 {
+		query.where("SchemaVersion", "$exists", false)
+	} else {
+		query.equals("SchemaVersion", fromVersion)
+	}
+	queryString, err := query.sortedQueryString("asc", "DocType", "_id")
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MigrationResult{}
+	for result.MigratedCount < pageSize && resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+
+		upgradedAsBytes, _, err := upgradeDocument(queryResult.Value)
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
+		}
+		documentAsBytes, err := stampMigration(upgradedAsBytes, caller)
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
+		}
+		err = putDocument(ctx, queryResult.Key, documentAsBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		result.MigratedKeys = append(result.MigratedKeys, queryResult.Key)
+		result.MigratedCount++
+	}
+
+	if result.MigratedCount == pageSize && resultsIterator.HasNext() {
+		result.Bookmark = result.MigratedKeys[len(result.MigratedKeys)-1]
+	}
+	if result.MigratedCount == 0 {
+		return result, nil
+	}
+
+	return result, emitEvent(ctx, EventDocumentsMigrated, &LedgerEvent{Keys: result.MigratedKeys, DocType: docType})
+}
+
+// stampMigration increments the Version of a raw document, since migration changes it under any client
+// that read it earlier. Products also record the migrating identity as their updater, so their history
+// attributes the migration to the administrator rather than to whoever updated the product before.
+func stampMigration(documentAsBytes []byte, caller *submitter) ([]byte, error) {
+	var document map[string]interface{}
+	err := json.Unmarshal(documentAsBytes, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	version, _ := document["Version"].(float64)
+	document["Version"] = int(version) + 1
+
+	if document["DocType"] == productObjectType {
+		document["ProductUpdaterMSPID"] = caller.mspID
+		document["ProductUpdaterClientID"] = caller.clientID
+	}
+
+	return json.Marshal(document)
+}
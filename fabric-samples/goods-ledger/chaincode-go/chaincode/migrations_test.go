@@ -0,0 +1,84 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateDocuments(t *testing.T) {
+	legacyProduct := []byte(`{"ProductOwnerAccountID":"account1","ProductManufacturingDate":"2020-09-01","ProductExpiryDate":"soon",` +
+		`"ProductUpdaterMSPID":"Org1MSP","ProductUpdaterClientID":"alice","Version":2,"DocType":"product"}`)
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturns(true)
+	iterator.NextReturns(&queryresult.KV{Key: "product1", Value: legacyProduct}, nil)
+
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{}, "Org1MSP", "admin")
+	chaincodeStub.GetQueryResultReturns(iterator, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.MigrateDocuments(transactionContext, "asset", 0, 10, "")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	_, err = goodsLedger.MigrateDocuments(transactionContext, "product", 2, 10, "")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	result, err := goodsLedger.MigrateDocuments(transactionContext, "product", 0, 1, "product0")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.MigrationResult{MigratedKeys: []string{"product1"}, MigratedCount: 1, Bookmark: "product1"}, result)
+
+	var query struct {
+		Selector map[string]interface{} `json:"selector"`
+		Sort     []map[string]string    `json:"sort"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(chaincodeStub.GetQueryResultArgsForCall(0)), &query))
+	require.Equal(t, map[string]interface{}{
+		"DocType":       "product",
+		"_id":           map[string]interface{}{"$gt": "product0"},
+		"SchemaVersion": map[string]interface{}{"$exists": false},
+	}, query.Selector)
+	require.Equal(t, []map[string]string{{"DocType": "asc"}, {"_id": "asc"}}, query.Sort)
+
+	key, bytes := chaincodeStub.PutStateArgsForCall(0)
+	require.Equal(t, "product1", key)
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(bytes, &product))
+	require.Equal(t, "2020-09-01T00:00:00Z", product.ProductManufacturingDate)
+	require.Equal(t, "soon", product.ProductExpiryDate)
+	require.Equal(t, 2, product.SchemaVersion)
+	require.Equal(t, 3, product.Version)
+	require.Equal(t, "Org1MSP", product.ProductUpdaterMSPID)
+	require.Equal(t, "admin", product.ProductUpdaterClientID)
+
+	eventName, _ := chaincodeStub.SetEventArgsForCall(0)
+	require.Equal(t, chaincode.EventDocumentsMigrated, eventName)
+
+	transactionContext.GetClientIdentity().(*mocks.ClientIdentity).AssertAttributeValueReturns(fmt.Errorf("attribute not found"))
+	_, err = goodsLedger.MigrateDocuments(transactionContext, "product", 0, 10, "")
+	requireErrorCode(t, err, chaincode.ErrUnauthorized)
+}
+
+func TestLegacyDocumentsUpgradeOnRead(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1": marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"account2": marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"product1": []byte(`{"ProductOwnerAccountID":"account1","ProductManufacturingDate":"2020-09-01","DocType":"product"}`),
+	}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+
+	goodsLedger := chaincode.SmartContract{}
+	err := goodsLedger.UpdateProductOwner(transactionContext, "product1", "account2", 0)
+	require.NoError(t, err)
+
+	_, bytes := chaincodeStub.PutStateArgsForCall(0)
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(bytes, &product))
+	require.Equal(t, "2020-09-01T00:00:00Z", product.ProductManufacturingDate)
+	require.Equal(t, 2, product.SchemaVersion)
+}
@@ -0,0 +1,197 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxUnpagedQueryResults caps how many records an unpaged query may return
+const maxUnpagedQueryResults = 1000
+
+// maxPageSize caps the page size accepted by the paginated queries
+const maxPageSize = 1000
+
+// validatePageSize fails unless the page size is between 1 and maxPageSize
+func validatePageSize(pageSize int32) error {
+	if pageSize < 1 || pageSize > maxPageSize {
+		return ledgerErrorf(ErrValidationFailed, "page size must be between 1 and %d", maxPageSize)
+	}
+
+	return nil
+}
+
+// PaginatedAssetQueryResult is one page of assets
+type PaginatedAssetQueryResult struct {
+	Records      []*Asset `json:"records"`
+	FetchedCount int32    `json:"fetchedCount"`
+	Bookmark     string   `json:"bookmark"`
+}
+
+// PaginatedAccountQueryResult is one page of accounts
+type PaginatedAccountQueryResult struct {
+	Records      []*Account `json:"records"`
+	FetchedCount int32      `json:"fetchedCount"`
+	Bookmark     string     `json:"bookmark"`
+}
+
+// PaginatedProductQueryResult is one page of products
+type PaginatedProductQueryResult struct {
+	Records      []*Product `json:"records"`
+	FetchedCount int32      `json:"fetchedCount"`
+	Bookmark     string     `json:"bookmark"`
+}
+
+// PaginatedManufacturerQueryResult is one page of manufacturers
+type PaginatedManufacturerQueryResult struct {
+	Records      []*Manufacturer `json:"records"`
+	FetchedCount int32           `json:"fetchedCount"`
+	Bookmark     string          `json:"bookmark"`
+}
+
+// PaginatedFactoryQueryResult is one page of factories
+type PaginatedFactoryQueryResult struct {
+	Records      []*Factory `json:"records"`
+	FetchedCount int32      `json:"fetchedCount"`
+	Bookmark     string     `json:"bookmark"`
+}
+
+// PaginatedTransferOfferQueryResult is one page of transfer offers
+type PaginatedTransferOfferQueryResult struct {
+	Records      []*TransferOffer `json:"records"`
+	FetchedCount int32            `json:"fetchedCount"`
+	Bookmark     string           `json:"bookmark"`
+}
+
+// PaginatedBatchQueryResult is one page of batches
+type PaginatedBatchQueryResult struct {
+	Records      []*Batch `json:"records"`
+	FetchedCount int32    `json:"fetchedCount"`
+	Bookmark     string   `json:"bookmark"`
+}
+
+// PaginatedRecallQueryResult is one page of recalls
+type PaginatedRecallQueryResult struct {
+	Records      []*Recall `json:"records"`
+	FetchedCount int32     `json:"fetchedCount"`
+	Bookmark     string    `json:"bookmark"`
+}
+
+// GetAllAssetsWithPagination returns one page of the assets found in world state.
+// Paginated queries are only supported in read-only transactions.
+func (s *SmartContract) GetAllAssetsWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PaginatedAssetQueryResult, error) {
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", pageSize, bookmark)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	assets, err := constructAssetQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedAssetQueryResult{
+		Records:      assets,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
+// QueryAccountbyUsernameWithPagination returns one page of the results of QueryAccountbyUsername.
+func (s *SmartContract) QueryAccountbyUsernameWithPagination(ctx contractapi.TransactionContextInterface,
+	accountUsername string, pageSize int32, bookmark string) (*PaginatedAccountQueryResult, error) {
+
+	return getAccountQueryResultForIndexWithPagination(ctx, pageSize, bookmark, accountByUsernameIndex, accountUsername)
+}
+
+// QueryManufacturerbyAccountIDWithPagination returns one page of the results of QueryManufacturerbyAccountID.
+func (s *SmartContract) QueryManufacturerbyAccountIDWithPagination(ctx contractapi.TransactionContextInterface,
+	manufacturerAccountID string, pageSize int32, bookmark string) (*PaginatedManufacturerQueryResult, error) {
+
+	return getManufacturerQueryResultForIndexWithPagination(ctx, pageSize, bookmark, manufacturerByAccountIndex, manufacturerAccountID)
+}
+
+// QueryManufacturerbyTradeLicenceIDWithPagination returns one page of the results of QueryManufacturerbyTradeLicenceID.
+func (s *SmartContract) QueryManufacturerbyTradeLicenceIDWithPagination(ctx contractapi.TransactionContextInterface,
+	manufacturerTradeLicenceID string, pageSize int32, bookmark string) (*PaginatedManufacturerQueryResult, error) {
+
+	return getManufacturerQueryResultForIndexWithPagination(ctx, pageSize, bookmark, manufacturerByTradeLicenceIndex, manufacturerTradeLicenceID)
+}
+
+// QueryFactorybyIDWithPagination returns one page of the results of QueryFactorybyID.
+func (s *SmartContract) QueryFactorybyIDWithPagination(ctx contractapi.TransactionContextInterface,
+	factoryID string, pageSize int32, bookmark string) (*PaginatedFactoryQueryResult, error) {
+
+	return getFactoryQueryResultForIndexWithPagination(ctx, pageSize, bookmark, factoryByIDIndex, factoryID)
+}
+
+// QueryFactorybyManufacturerIDWithPagination returns one page of the results of QueryFactorybyManufacturerID.
+func (s *SmartContract) QueryFactorybyManufacturerIDWithPagination(ctx contractapi.TransactionContextInterface,
+	factoryManufacturerID string, pageSize int32, bookmark string) (*PaginatedFactoryQueryResult, error) {
+
+	return getFactoryQueryResultForIndexWithPagination(ctx, pageSize, bookmark, factoryByManufacturerIndex, factoryManufacturerID)
+}
+
+// QueryProductbyIDWithPagination returns one page of the results of QueryProductbyID.
+func (s *SmartContract) QueryProductbyIDWithPagination(ctx contractapi.TransactionContextInterface,
+	productID string, pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	return getProductQueryResultForIndexWithPagination(ctx, pageSize, bookmark, productByIDIndex, productID)
+}
+
+// QueryProductbyOwnerAccountIDWithPagination returns one page of the results of QueryProductbyOwnerAccountID.
+func (s *SmartContract) QueryProductbyOwnerAccountIDWithPagination(ctx contractapi.TransactionContextInterface,
+	productOwnerAccountID string, pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	return getProductQueryResultForIndexWithPagination(ctx, pageSize, bookmark, productByOwnerIndex, productOwnerAccountID)
+}
+
+// QueryProductbyManufacturerIDWithPagination returns one page of the results of QueryProductbyManufacturerID.
+func (s *SmartContract) QueryProductbyManufacturerIDWithPagination(ctx contractapi.TransactionContextInterface,
+	productManufacturerID string, pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	return getProductQueryResultForIndexWithPagination(ctx, pageSize, bookmark, productByManufacturerIndex, productManufacturerID)
+}
+
+// QueryProductbyFactoryIDWithPagination returns one page of the results of QueryProductbyFactoryID.
+func (s *SmartContract) QueryProductbyFactoryIDWithPagination(ctx contractapi.TransactionContextInterface,
+	productFactoryID string, pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	return getProductQueryResultForIndexWithPagination(ctx, pageSize, bookmark, productByFactoryIndex, productFactoryID)
+}
+
+func getProductQueryResultForSelectorWithPagination(ctx contractapi.TransactionContextInterface, query selector,
+	pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString, err := query.queryString()
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	products, err := constructProductQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedProductQueryResult{
+		Records:      products,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
@@ -0,0 +1,54 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryProductbyManufacturerIDWithPagination(t *testing.T) {
+	product := &chaincode.Product{ProductManufacturerID: "manufacturer1", ProductID: "p1", DocType: "product"}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{"product1": marshalDocument(t, product)}, "Org1MSP", "alice")
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturnsOnCall(0, true)
+	iterator.HasNextReturnsOnCall(1, false)
+	iterator.NextReturns(&queryresult.KV{Key: "\x00product~manufacturer~key\x00manufacturer1\x00product1\x00", Value: []byte{0x00}}, nil)
+	chaincodeStub.GetStateByPartialCompositeKeyWithPaginationReturns(iterator, &peer.QueryResponseMetadata{FetchedRecordsCount: 1, Bookmark: "next"}, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.QueryProductbyManufacturerIDWithPagination(transactionContext, "manufacturer1", 0, "")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	page, err := goodsLedger.QueryProductbyManufacturerIDWithPagination(transactionContext, "manufacturer1", 10, "previous")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.PaginatedProductQueryResult{
+		Records:      []*chaincode.Product{product},
+		FetchedCount: 1,
+		Bookmark:     "next",
+	}, page)
+
+	index, attributes, pageSize, bookmark := chaincodeStub.GetStateByPartialCompositeKeyWithPaginationArgsForCall(0)
+	require.Equal(t, "product~manufacturer~key", index)
+	require.Equal(t, []string{"manufacturer1"}, attributes)
+	require.Equal(t, int32(10), pageSize)
+	require.Equal(t, "previous", bookmark)
+}
+
+func TestUnpagedQueryCap(t *testing.T) {
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{}, "Org1MSP", "alice")
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturns(true)
+	iterator.NextReturns(&queryresult.KV{Key: "product1", Value: marshalDocument(t, &chaincode.Product{DocType: "product"})}, nil)
+	chaincodeStub.GetQueryResultReturns(iterator, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.QueryExpiredProducts(transactionContext)
+	requireErrorCode(t, err, chaincode.ErrTooManyResults)
+	require.Equal(t, 1001, iterator.NextCallCount())
+}
@@ -0,0 +1,86 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ReadAccount returns the account stored in the world state with given key
+func (s *SmartContract) ReadAccount(ctx contractapi.TransactionContextInterface, accountKey string) (*Account, error) {
+	return readAccount(ctx, accountKey)
+}
+
+// ReadManufacturer returns the manufacturer stored in the world state with given key
+func (s *SmartContract) ReadManufacturer(ctx contractapi.TransactionContextInterface, manufacturerKey string) (*Manufacturer, error) {
+	return readManufacturer(ctx, manufacturerKey)
+}
+
+// ReadFactory returns the factory stored in the world state with given key
+func (s *SmartContract) ReadFactory(ctx contractapi.TransactionContextInterface, factoryKey string) (*Factory, error) {
+	return readFactory(ctx, factoryKey)
+}
+
+// ReadProduct returns the product stored in the world state with given key
+func (s *SmartContract) ReadProduct(ctx contractapi.TransactionContextInterface, productKey string) (*Product, error) {
+	return readProduct(ctx, productKey)
+}
+
+// QueryAccountKeybyUsername returns the keys of the accounts with given username, so a client that only knows
+// the username can read the account's credentials with ReadAccountPasswordHash
+func (s *SmartContract) QueryAccountKeybyUsername(ctx contractapi.TransactionContextInterface, accountUsername string) ([]string, error) {
+	entriesIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountByUsernameIndex, keyAttributes([]string{accountUsername}))
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer entriesIterator.Close()
+
+	accountKeys := []string{}
+	for entriesIterator.HasNext() {
+		entry, err := entriesIterator.Next()
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+
+		accountKey, err := indexedDocumentKey(ctx, entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		accountKeys = append(accountKeys, accountKey)
+	}
+
+	return accountKeys, nil
+}
+
+// AccountExists returns true when an account is stored in the world state with given key
+func (s *SmartContract) AccountExists(ctx contractapi.TransactionContextInterface, accountKey string) (bool, error) {
+	return documentExists(ctx, accountObjectType, accountKey)
+}
+
+// ManufacturerExists returns true when a manufacturer is stored in the world state with given key
+func (s *SmartContract) ManufacturerExists(ctx contractapi.TransactionContextInterface, manufacturerKey string) (bool, error) {
+	return documentExists(ctx, manufacturerObjectType, manufacturerKey)
+}
+
+// FactoryExists returns true when a factory is stored in the world state with given key
+func (s *SmartContract) FactoryExists(ctx contractapi.TransactionContextInterface, factoryKey string) (bool, error) {
+	return documentExists(ctx, factoryObjectType, factoryKey)
+}
+
+// ProductExists returns true when a product is stored in the world state with given key
+func (s *SmartContract) ProductExists(ctx contractapi.TransactionContextInterface, productKey string) (bool, error) {
+	return documentExists(ctx, productObjectType, productKey)
+}
+
+// documentExists reports whether a document of the given DocType is stored under key;
+// a document of any other type under the same key does not count
+func documentExists(ctx contractapi.TransactionContextInterface, docType string, key string) (bool, error) {
+	var document struct {
+		DocType string `json:"DocType"`
+	}
+
+	exists, err := readDocument(ctx, key, &document)
+	if err != nil {
+		return false, err
+	}
+
+	return exists && document.DocType == docType, nil
+}
@@ -0,0 +1,85 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedReads(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+		"product1":      marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", ProductName: "Soap", DocType: "product"}),
+		"disguised":     marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", DocType: "account"}),
+	}
+
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	goodsLedger := chaincode.SmartContract{}
+
+	product, err := goodsLedger.ReadProduct(transactionContext, "product1")
+	require.NoError(t, err)
+	require.Equal(t, "Soap", product.ProductName)
+
+	_, err = goodsLedger.ReadProduct(transactionContext, "account1")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	_, err = goodsLedger.ReadAccount(transactionContext, "product1")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	_, err = goodsLedger.ReadManufacturer(transactionContext, "manufacturer1")
+	require.NoError(t, err)
+
+	_, err = goodsLedger.ReadFactory(transactionContext, "manufacturer1")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	exists, err := goodsLedger.ProductExists(transactionContext, "product1")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = goodsLedger.ProductExists(transactionContext, "disguised")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	exists, err = goodsLedger.AccountExists(transactionContext, "missing")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	exists, err = goodsLedger.FactoryExists(transactionContext, "factory1")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = goodsLedger.ManufacturerExists(transactionContext, "factory1")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	err = goodsLedger.UpdateProductOwner(transactionContext, "disguised", "account1", 0)
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestDocTypeSetByChaincode(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+	}
+
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	goodsLedger := chaincode.SmartContract{}
+
+	_, err := goodsLedger.AddProduct(transactionContext, "account1", "manufacturer1", "", "factory1", "sku", "Soap", "cosmetics", "batch1", "7", "", "2020-09-01", "", "account")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	_, err = goodsLedger.AddProduct(transactionContext, "account1", "manufacturer1", "", "factory1", "sku", "Soap", "cosmetics", "batch1", "7", "", "2020-09-01", "", "")
+	require.NoError(t, err)
+
+	_, bytes := chaincodeStub.PutStateArgsForCall(0)
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(bytes, &product))
+	require.Equal(t, "product", product.DocType)
+}
@@ -0,0 +1,264 @@
+package chaincode
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Recall statuses of products and recall records
+const (
+	productRecalled    = "recalled"
+	recallStatusActive = "active"
+	recallStatusClosed = "closed"
+)
+
+// Recall records a manufacturer's recall of unsafe products. RecallBatchID is only set for recalls of a whole batch.
+type Recall struct {
+	RecallManufacturerID string   `json:"RecallManufacturerID"`
+	RecallBatchID        string   `json:"RecallBatchID"`
+	RecallProductKeys    []string `json:"RecallProductKeys"`
+	RecallReason         string   `json:"RecallReason"`
+	RecallStatus         string   `json:"RecallStatus"`
+	RecalledAt           string   `json:"RecalledAt"`
+	SchemaVersion        int      `json:"SchemaVersion"`
+	Version              int      `json:"Version"`
+	DocType              string   `json:"DocType"`
+}
+
+// RecallBatch recalls every product of the batch and returns the key of the recall record
+func (s *SmartContract) RecallBatch(ctx contractapi.TransactionContextInterface, batchKey string, reason string) (string, error) {
+	batch, err := s.ReadBatch(ctx, batchKey)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = requireManufacturerOwner(ctx, batch.BatchManufacturerID)
+	if err != nil {
+		return "", err
+	}
+
+	// products added one by one under the batch ID are recalled too, so the batch is looked up by index
+	// rather than by its minted serials
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(productByBatchIndex,
+		keyAttributes([]string{batch.BatchManufacturerID, batch.BatchID}))
+	if err != nil {
+		return "", ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var productKeys []string
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return "", ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		productKey, err := indexedDocumentKey(ctx, queryResult.Key)
+		if err != nil {
+			return "", err
+		}
+		productKeys = append(productKeys, productKey)
+	}
+
+	return recallProducts(ctx, batch.BatchManufacturerID, batch.BatchID, productKeys, reason)
+}
+
+// RecallProducts recalls the given products of the manufacturer and returns the key of the recall record
+func (s *SmartContract) RecallProducts(ctx contractapi.TransactionContextInterface,
+	manufacturerID string, productKeys []string, reason string) (string, error) {
+
+	_, err := requireManufacturerOwner(ctx, manufacturerID)
+	if err != nil {
+		return "", err
+	}
+
+	return recallProducts(ctx, manufacturerID, "", productKeys, reason)
+}
+
+// CloseRecall marks the recall as no longer active. The recalled products stay recalled.
+func (s *SmartContract) CloseRecall(ctx contractapi.TransactionContextInterface, recallKey string) error {
+	recall, err := s.ReadRecall(ctx, recallKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = requireManufacturerOwner(ctx, recall.RecallManufacturerID)
+	if err != nil {
+		return err
+	}
+
+	recall.RecallStatus = recallStatusClosed
+	recall.SchemaVersion = currentSchemaVersion(recallObjectType)
+	recall.Version++
+	recallAsBytes, err := json.Marshal(recall)
+	if err != nil {
+		return err
+	}
+
+	err = putDocument(ctx, recallKey, recallAsBytes)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventRecallClosed, &LedgerEvent{
+		Key:            recallKey,
+		DocType:        recallObjectType,
+		ManufacturerID: recall.RecallManufacturerID,
+	})
+}
+
+// ReadRecall returns the recall stored in the world state with given key
+func (s *SmartContract) ReadRecall(ctx contractapi.TransactionContextInterface, recallKey string) (*Recall, error) {
+	var recall Recall
+	exists, err := readDocument(ctx, recallKey, &recall)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || recall.DocType != recallObjectType {
+		return nil, ledgerErrorf(ErrNotFound, "the recall %s does not exist", recallKey)
+	}
+
+	return &recall, nil
+}
+
+// QueryActiveRecalls returns every recall that has not been closed
+func (s *SmartContract) QueryActiveRecalls(ctx contractapi.TransactionContextInterface) ([]*Recall, error) {
+	return getRecallQueryResultForIndex(ctx, recallByStatusIndex, recallStatusActive)
+}
+
+// QueryActiveRecallsWithPagination returns one page of the results of QueryActiveRecalls.
+func (s *SmartContract) QueryActiveRecallsWithPagination(ctx contractapi.TransactionContextInterface,
+	pageSize int32, bookmark string) (*PaginatedRecallQueryResult, error) {
+
+	return getRecallQueryResultForIndexWithPagination(ctx, pageSize, bookmark, recallByStatusIndex, recallStatusActive)
+}
+
+// QueryRecalledProductbyOwnerAccountID returns the products of the account that are under recall
+func (s *SmartContract) QueryRecalledProductbyOwnerAccountID(ctx contractapi.TransactionContextInterface,
+	productOwnerAccountID string) ([]*Product, error) {
+
+	return getProductQueryResultForIndex(ctx, productByOwnerRecallIndex, productOwnerAccountID, productRecalled)
+}
+
+// QueryRecalledProductbyOwnerAccountIDWithPagination returns one page of the results of
+// QueryRecalledProductbyOwnerAccountID.
+func (s *SmartContract) QueryRecalledProductbyOwnerAccountIDWithPagination(ctx contractapi.TransactionContextInterface,
+	productOwnerAccountID string, pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	return getProductQueryResultForIndexWithPagination(ctx, pageSize, bookmark, productByOwnerRecallIndex, productOwnerAccountID, productRecalled)
+}
+
+// recallProducts marks the products as recalled and stores the recall record
+func recallProducts(ctx contractapi.TransactionContextInterface,
+	manufacturerID string, batchID string, productKeys []string, reason string) (string, error) {
+
+	fieldErrors := recallValidations.check(&Recall{RecallReason: reason})
+	if len(productKeys) == 0 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "RecallProductKeys", Message: "RecallProductKeys must list at least one product"})
+	}
+	err := validationError(fieldErrors)
+	if err != nil {
+		return "", err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	recalledAt := formatLedgerTime(txTime)
+
+	recallKey, err := newDocumentKey(ctx, recallObjectType)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireAbsent(ctx, recallObjectType, recallKey)
+	if err != nil {
+		return "", err
+	}
+
+	for _, productKey := range productKeys {
+		product, err := readProduct(ctx, productKey)
+		if err != nil {
+			return "", err
+		}
+		if product.ProductManufacturerID != manufacturerID {
+			return "", ledgerErrorf(ErrValidationFailed, "the product %s was not made by manufacturer %s", productKey, manufacturerID)
+		}
+
+		product.ProductRecallStatus = productRecalled
+		product.ProductRecallID = recallKey
+		product.ProductRecallReason = reason
+		product.ProductRecalledAt = recalledAt
+		err = putProduct(ctx, productKey, product)
+		if err != nil {
+			return "", err
+		}
+
+		// a recalled product cannot change hands, so pending offers are withdrawn
+		err = deleteTransferOffer(ctx, productKey)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	recall := Recall{
+		RecallManufacturerID: manufacturerID,
+		RecallBatchID:        batchID,
+		RecallProductKeys:    productKeys,
+		RecallReason:         reason,
+		RecallStatus:         recallStatusActive,
+		RecalledAt:           recalledAt,
+		SchemaVersion:        currentSchemaVersion(recallObjectType),
+		Version:              1,
+		DocType:              recallObjectType,
+	}
+	recallAsBytes, err := json.Marshal(recall)
+	if err != nil {
+		return "", err
+	}
+
+	err = putDocument(ctx, recallKey, recallAsBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return recallKey, emitEvent(ctx, EventRecallIssued, &LedgerEvent{
+		Key:            recallKey,
+		Keys:           productKeys,
+		DocType:        recallObjectType,
+		ManufacturerID: manufacturerID,
+	})
+}
+
+// requireNotRecalled fails when the product is under recall
+func requireNotRecalled(productKey string, product *Product) error {
+	if product.ProductRecallStatus == productRecalled {
+		return ledgerErrorf(ErrRecalled, "the product %s is under recall and cannot be transferred", productKey)
+	}
+
+	return nil
+}
+
+func constructRecallQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Recall, error) {
+	var recalls []*Recall
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(recalls) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d recalls, use its paginated variant", maxUnpagedQueryResults)
+		}
+
+		var recall Recall
+		err = json.Unmarshal(queryResult.Value, &recall)
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
+		}
+		recalls = append(recalls, &recall)
+	}
+
+	return recalls, nil
+}
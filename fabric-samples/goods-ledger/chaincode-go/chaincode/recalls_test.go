@@ -0,0 +1,150 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/ledgertest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecallProducts(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"account2":      marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerAccountID: "account1", ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+		"product1": marshalDocument(t, &chaincode.Product{
+			ProductOwnerAccountID:   "account1",
+			ProductManufacturerID:   "manufacturer1",
+			ProductManufacturerName: "Acme",
+			ProductFactoryID:        "factory1",
+			DocType:                 "product",
+		}),
+		"product2": marshalDocument(t, &chaincode.Product{ProductManufacturerID: "manufacturer2", DocType: "product"}),
+	}
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		worldState[key] = value
+		return nil
+	}
+
+	goodsLedger := chaincode.SmartContract{}
+	_, err := goodsLedger.RecallProducts(transactionContext, "manufacturer1", []string{"product2"}, "contamination")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	_, err = goodsLedger.RecallProducts(transactionContext, "manufacturer1", nil, strings.Repeat("x", 1025))
+	requireFieldErrors(t, err, "RecallReason", "RecallProductKeys")
+
+	recallKey, err := goodsLedger.RecallProducts(transactionContext, "manufacturer1", []string{"product1"}, "contamination")
+	require.NoError(t, err)
+	require.Equal(t, "\x00recall\x00tx1\x00", recallKey)
+
+	eventName, payload := chaincodeStub.SetEventArgsForCall(0)
+	require.Equal(t, chaincode.EventRecallIssued, eventName)
+	var issued chaincode.LedgerEvent
+	require.NoError(t, json.Unmarshal(payload, &issued))
+	require.Equal(t, recallKey, issued.Key)
+	require.Equal(t, []string{"product1"}, issued.Keys)
+
+	recall, err := goodsLedger.ReadRecall(transactionContext, recallKey)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Recall{
+		RecallManufacturerID: "manufacturer1",
+		RecallProductKeys:    []string{"product1"},
+		RecallReason:         "contamination",
+		RecallStatus:         "active",
+		RecalledAt:           "2020-09-13T12:26:40Z",
+		SchemaVersion:        2,
+		Version:              1,
+		DocType:              "recall",
+	}, recall)
+
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(worldState["product1"], &product))
+	require.Equal(t, "recalled", product.ProductRecallStatus)
+	require.Equal(t, recallKey, product.ProductRecallID)
+	require.Equal(t, "contamination", product.ProductRecallReason)
+
+	err = goodsLedger.UpdateProductOwner(transactionContext, "product1", "account2", 1)
+	requireErrorCode(t, err, chaincode.ErrRecalled)
+
+	err = goodsLedger.OfferProductTransfer(transactionContext, "product1", "account2", "2030-01-01")
+	requireErrorCode(t, err, chaincode.ErrRecalled)
+
+	verdict, err := goodsLedger.VerifyProduct(transactionContext, "product1")
+	require.NoError(t, err)
+	require.False(t, verdict.Genuine)
+	require.True(t, verdict.Recalled)
+	require.Equal(t, []string{"product is under recall: contamination"}, verdict.Problems)
+
+	err = goodsLedger.CloseRecall(transactionContext, recallKey)
+	require.NoError(t, err)
+	recall, err = goodsLedger.ReadRecall(transactionContext, recallKey)
+	require.NoError(t, err)
+	require.Equal(t, "closed", recall.RecallStatus)
+}
+
+func TestQueryRecalledProductbyOwnerAccountID(t *testing.T) {
+	stub := ledgertest.NewStub()
+	alice := newScenarioContext(stub, "Org1MSP", "alice")
+	goodsLedger := chaincode.SmartContract{}
+
+	aliceAccount := registerScenarioAccount(t, stub, alice, "tx-register-alice", "alice", "alice@example.com")
+
+	var manufacturerKey string
+	err := stub.Transact("tx-manufacturer", func() (err error) {
+		manufacturerKey, err = goodsLedger.AddManufacturer(alice, aliceAccount, "Acme", "licence1", "Dhaka", "2001-05-01", "manufacturer")
+		return err
+	})
+	require.NoError(t, err)
+
+	var factoryKey string
+	err = stub.Transact("tx-factory", func() (err error) {
+		factoryKey, err = goodsLedger.AddFactory(alice, manufacturerKey, "factory1", "Plant", "Dhaka", "factory")
+		return err
+	})
+	require.NoError(t, err)
+
+	var productKeys []string
+	for _, productID := range []string{"sku1", "sku2"} {
+		err = stub.Transact("tx-"+productID, func() error {
+			productKey, err := goodsLedger.AddProduct(alice, aliceAccount, manufacturerKey, "Acme", factoryKey, productID, "Soap",
+				"cosmetics", "batch1", productID, "Dhaka", "2020-09-01", "2021-09-01", "product")
+			productKeys = append(productKeys, productKey)
+			return err
+		})
+		require.NoError(t, err)
+	}
+
+	err = stub.Transact("tx-recall", func() error {
+		_, err := goodsLedger.RecallProducts(alice, manufacturerKey, productKeys[:1], "contamination")
+		return err
+	})
+	require.NoError(t, err)
+
+	// only the recalled product gets an entry in the owner and recall status index
+	var recallEntries int
+	for _, key := range stub.Keys() {
+		objectType, _, err := stub.SplitCompositeKey(key)
+		if err == nil && objectType == "product~owner~recall~key" {
+			recallEntries++
+		}
+	}
+	require.Equal(t, 1, recallEntries)
+
+	products, err := goodsLedger.QueryRecalledProductbyOwnerAccountID(alice, aliceAccount)
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	require.Equal(t, "sku1", products[0].ProductID)
+
+	page, err := goodsLedger.QueryRecalledProductbyOwnerAccountIDWithPagination(alice, aliceAccount, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+
+	products, err = goodsLedger.QueryRecalledProductbyOwnerAccountID(alice, "account2")
+	require.NoError(t, err)
+	require.Empty(t, products)
+}
@@ -0,0 +1,78 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// requireReference fails unless key refers to an existing document of the given DocType
+func requireReference(ctx contractapi.TransactionContextInterface, docType string, key string) error {
+	var document struct {
+		DocType string `json:"DocType"`
+	}
+
+	exists, err := readDocument(ctx, key, &document)
+	if err != nil {
+		return err
+	}
+	if !exists || document.DocType != docType {
+		return ledgerErrorf(ErrNotFound, "the %s %s does not exist", docType, key)
+	}
+
+	return nil
+}
+
+// requireDocType fails unless the DocType passed by a client is empty or the one the chaincode stores itself
+func requireDocType(docType string, objectType string) error {
+	if docType != "" && docType != objectType {
+		return ledgerErrorf(ErrValidationFailed, "the DocType must be %s, not %s", objectType, docType)
+	}
+
+	return nil
+}
+
+// requireAbsent fails when a document is already stored under key, so creating a document never overwrites one
+func requireAbsent(ctx contractapi.TransactionContextInterface, docType string, key string) error {
+	documentAsBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to read from world state: %v", err)
+	}
+	if documentAsBytes != nil {
+		return ledgerErrorf(ErrAlreadyExists, "the %s %s already exists", docType, key)
+	}
+
+	return nil
+}
+
+// requireVersion fails with CONFLICT unless the stored document is still at the version the client read,
+// so concurrent edits cannot silently overwrite each other
+func requireVersion(docType string, key string, version int, expectedVersion int) error {
+	if version != expectedVersion {
+		return ledgerErrorf(ErrConflict, "the %s %s is at version %d, not %d", docType, key, version, expectedVersion)
+	}
+
+	return nil
+}
+
+// requireFactoryOfManufacturer fails unless the factory exists and belongs to the given manufacturer
+func requireFactoryOfManufacturer(ctx contractapi.TransactionContextInterface, factoryKey string, manufacturerKey string) error {
+	factory, err := readFactory(ctx, factoryKey)
+	if err != nil {
+		return err
+	}
+	if factory.FactoryManufacturerID != manufacturerKey {
+		return ledgerErrorf(ErrValidationFailed, "the factory %s does not belong to manufacturer %s", factoryKey, manufacturerKey)
+	}
+
+	return nil
+}
+
+// factoryHasProducts returns true when any product references the factory with given key
+func factoryHasProducts(ctx contractapi.TransactionContextInterface, factoryKey string) (bool, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(productByFactoryIndex, keyAttributes([]string{factoryKey}))
+	if err != nil {
+		return false, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	return resultsIterator.HasNext(), nil
+}
@@ -0,0 +1,169 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/ledgertest"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// newScenarioContext returns a transaction context submitting to the in-memory stub as the given identity
+func newScenarioContext(stub *ledgertest.Stub, mspID string, clientID string) *contractapi.TransactionContext {
+	clientIdentity := &mocks.ClientIdentity{}
+	clientIdentity.GetMSPIDReturns(mspID, nil)
+	clientIdentity.GetIDReturns(clientID, nil)
+
+	transactionContext := &contractapi.TransactionContext{}
+	transactionContext.SetStub(stub)
+	transactionContext.SetClientIdentity(clientIdentity)
+
+	return transactionContext
+}
+
+// registerScenarioAccount registers an account for the identity in its own transaction
+func registerScenarioAccount(t *testing.T, stub *ledgertest.Stub, transactionContext *contractapi.TransactionContext,
+	txID string, username string, email string) string {
+
+	stub.Transient = map[string][]byte{
+		"account_secret":  marshalDocument(t, &chaincode.AccountSecretInput{AccountPassword: "secret", AccountToken: username + "-" + sessionToken}),
+		"account_details": marshalDocument(t, &chaincode.AccountDetails{AccountName: username, AccountEmail: email}),
+	}
+
+	var accountKey string
+	err := stub.Transact(txID, func() (err error) {
+		accountKey, err = (&chaincode.SmartContract{}).RegisterAccount(transactionContext, "customer", username, "", "account")
+		return err
+	})
+	require.NoError(t, err)
+
+	return accountKey
+}
+
+func TestProductLifecycleScenario(t *testing.T) {
+	stub := ledgertest.NewStub()
+	alice := newScenarioContext(stub, "Org1MSP", "alice")
+	bob := newScenarioContext(stub, "Org2MSP", "bob")
+	goodsLedger := chaincode.SmartContract{}
+
+	aliceAccount := registerScenarioAccount(t, stub, alice, "tx-register-alice", "alice", "alice@example.com")
+	bobAccount := registerScenarioAccount(t, stub, bob, "tx-register-bob", "bob", "bob@example.com")
+
+	verifier, err := goodsLedger.ReadAccountPasswordHash(alice, aliceAccount)
+	require.NoError(t, err)
+	require.Equal(t, "pbkdf2-sha256", verifier.Algorithm)
+	require.NotContains(t, verifier.Hash, "secret")
+	require.Equal(t, 1, verifier.Version)
+
+	accountKeys, err := goodsLedger.QueryAccountKeybyUsername(bob, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []string{aliceAccount}, accountKeys)
+
+	_, err = goodsLedger.ReadAccountPasswordHash(bob, aliceAccount)
+	requireErrorCode(t, err, chaincode.ErrUnauthorized)
+
+	var manufacturerKey string
+	err = stub.Transact("tx-manufacturer", func() (err error) {
+		manufacturerKey, err = goodsLedger.AddManufacturer(alice, aliceAccount, "Acme", "licence1", "Dhaka", "2001-05-01", "manufacturer")
+		return err
+	})
+	require.NoError(t, err)
+
+	var factoryKey string
+	err = stub.Transact("tx-factory", func() (err error) {
+		factoryKey, err = goodsLedger.AddFactory(alice, manufacturerKey, "factory1", "Plant", "Dhaka", "factory")
+		return err
+	})
+	require.NoError(t, err)
+
+	var productKey string
+	err = stub.Transact("tx-product", func() (err error) {
+		productKey, err = goodsLedger.AddProduct(alice, aliceAccount, manufacturerKey, "Acme", factoryKey, "sku1", "Soap",
+			"cosmetics", "batch1", "1", "Dhaka", "2020-09-01", "2021-09-01", "product")
+		return err
+	})
+	require.NoError(t, err)
+
+	// a failed transaction leaves no trace in the world state
+	keysBefore := stub.Keys()
+	err = stub.Transact("tx-duplicate", func() error {
+		_, err := goodsLedger.AddProduct(alice, aliceAccount, manufacturerKey, "Acme", factoryKey, "sku1", "Soap",
+			"cosmetics", "batch1", "1", "Dhaka", "2020-09-01", "2021-09-01", "product")
+		return err
+	})
+	requireErrorCode(t, err, chaincode.ErrAlreadyExists)
+	require.Equal(t, keysBefore, stub.Keys())
+
+	err = stub.Transact("tx-offer", func() error {
+		return goodsLedger.OfferProductTransfer(alice, productKey, bobAccount, "2020-09-20")
+	})
+	require.NoError(t, err)
+
+	offers, err := goodsLedger.QueryTransferOfferbyToAccountID(bob, bobAccount)
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+	require.Equal(t, aliceAccount, offers[0].FromAccountID)
+
+	err = stub.Transact("tx-accept-by-alice", func() error {
+		return goodsLedger.AcceptProductTransfer(alice, productKey)
+	})
+	requireErrorCode(t, err, chaincode.ErrUnauthorized)
+
+	err = stub.Transact("tx-accept", func() error {
+		return goodsLedger.AcceptProductTransfer(bob, productKey)
+	})
+	require.NoError(t, err)
+
+	products, err := goodsLedger.QueryProductbyOwnerAccountID(bob, bobAccount)
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	require.Equal(t, "Soap", products[0].ProductName)
+
+	products, err = goodsLedger.QueryProductbyOwnerAccountID(alice, aliceAccount)
+	require.NoError(t, err)
+	require.Empty(t, products)
+
+	offers, err = goodsLedger.QueryTransferOfferbyToAccountID(bob, bobAccount)
+	require.NoError(t, err)
+	require.Empty(t, offers)
+
+	search, err := goodsLedger.SearchProducts(bob, `{"ProductName":{"prefix":"So"}}`, "ProductExpiryDate:desc", 10, "")
+	require.NoError(t, err)
+	require.Len(t, search.Records, 1)
+	require.Equal(t, bobAccount, search.Records[0].ProductOwnerAccountID)
+
+	history, err := goodsLedger.GetProductHistory(bob, productKey)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "tx-accept", history[0].TxID)
+	require.Equal(t, bobAccount, history[0].Record.ProductOwnerAccountID)
+	require.Equal(t, "tx-product", history[1].TxID)
+	require.Equal(t, aliceAccount, history[1].Record.ProductOwnerAccountID)
+
+	accounts, err := goodsLedger.QueryAccountbyEmail(bob, "BOB@example.com")
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	require.Equal(t, "bob", accounts[0].AccountUsername)
+
+	var eventNames []string
+	for _, event := range stub.Events() {
+		eventNames = append(eventNames, event.EventName)
+	}
+	require.Equal(t, []string{
+		chaincode.EventAccountRegistered,
+		chaincode.EventAccountRegistered,
+		chaincode.EventManufacturerAdded,
+		chaincode.EventFactoryAdded,
+		chaincode.EventProductCreated,
+		chaincode.EventProductTransferOffered,
+		chaincode.EventProductOwnerChanged,
+	}, eventNames)
+
+	var transferred chaincode.LedgerEvent
+	require.NoError(t, json.Unmarshal(stub.Events()[6].Payload, &transferred))
+	require.Equal(t, aliceAccount, transferred.OldOwnerAccountID)
+	require.Equal(t, bobAccount, transferred.NewOwnerAccountID)
+}
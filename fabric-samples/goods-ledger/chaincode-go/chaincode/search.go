@@ -0,0 +1,220 @@
+package chaincode
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Operators accepted in a SearchProducts filter
+const (
+	filterEquals = "eq"
+	filterIn     = "in"
+	filterRange  = "range"
+	filterPrefix = "prefix"
+)
+
+// maxFilterInValues caps how many values an "in" condition may list
+const maxFilterInValues = 100
+
+// productSearchFields whitelists the product fields SearchProducts filters on and the operators allowed on each
+var productSearchFields = map[string][]string{
+	"ProductOwnerAccountID":        {filterEquals, filterIn},
+	"ProductManufacturerID":        {filterEquals, filterIn},
+	"ProductFactoryID":             {filterEquals, filterIn},
+	"ProductID":                    {filterEquals, filterIn},
+	"ProductType":                  {filterEquals, filterIn},
+	"ProductBatch":                 {filterEquals, filterIn},
+	"ProductSerialinBatch":         {filterEquals, filterIn},
+	"ProductManufacturingLocation": {filterEquals, filterIn},
+	"ProductRecallStatus":          {filterEquals, filterIn},
+	"ProductName":                  {filterEquals, filterIn, filterPrefix},
+	"ProductManufacturingDate":     {filterRange},
+	"ProductExpiryDate":            {filterRange},
+}
+
+// productSortFields whitelists the fields SearchProducts sorts on; each has an index next to DocType
+var productSortFields = map[string]bool{
+	"ProductName":              true,
+	"ProductManufacturingDate": true,
+	"ProductExpiryDate":        true,
+}
+
+// productFilterCondition is the condition on one field of a SearchProducts filter. From and To bound
+// a date range and are both inclusive. A To without a time of day covers that whole day, so it
+// matches dates before the start of the next day rather than only up to its midnight.
+type productFilterCondition struct {
+	Eq     *string  `json:"eq"`
+	In     []string `json:"in"`
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Prefix *string  `json:"prefix"`
+}
+
+// operators lists the filter operators the condition uses
+func (condition *productFilterCondition) operators() []string {
+	var operators []string
+	if condition.Eq != nil {
+		operators = append(operators, filterEquals)
+	}
+	if condition.In != nil {
+		operators = append(operators, filterIn)
+	}
+	if condition.From != "" || condition.To != "" {
+		operators = append(operators, filterRange)
+	}
+	if condition.Prefix != nil {
+		operators = append(operators, filterPrefix)
+	}
+
+	return operators
+}
+
+// compileProductFilter turns a SearchProducts filter into a product selector. Field names and operators
+// come from the whitelists above and values are only marshalled, so the filter cannot reach other
+// DocTypes or inject Mango operators.
+func compileProductFilter(filterJSON string) (selector, error) {
+	query := newSelector(productObjectType)
+	if strings.TrimSpace(filterJSON) == "" {
+		return query, nil
+	}
+
+	var filter map[string]*productFilterCondition
+	decoder := json.NewDecoder(bytes.NewReader([]byte(filterJSON)))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&filter)
+	if err != nil {
+		return nil, ledgerErrorf(ErrValidationFailed, "the product filter is not valid: %v", err)
+	}
+
+	for field, condition := range filter {
+		allowed, ok := productSearchFields[field]
+		if !ok {
+			return nil, ledgerErrorf(ErrValidationFailed, "products cannot be searched by %s", field)
+		}
+		if condition == nil || len(condition.operators()) == 0 {
+			return nil, ledgerErrorf(ErrValidationFailed, "the filter on %s has no condition", field)
+		}
+
+		for _, operator := range condition.operators() {
+			if !containsString(allowed, operator) {
+				return nil, ledgerErrorf(ErrValidationFailed, "the %s filter is not supported on %s", operator, field)
+			}
+		}
+
+		if condition.Eq != nil {
+			query.equals(field, *condition.Eq)
+		}
+		if condition.In != nil {
+			if len(condition.In) == 0 || len(condition.In) > maxFilterInValues {
+				return nil, ledgerErrorf(ErrValidationFailed, "the in filter on %s must list between 1 and %d values", field, maxFilterInValues)
+			}
+			query.where(field, "$in", condition.In)
+		}
+		if condition.From != "" {
+			from, _, err := normalizeLedgerDate(condition.From)
+			if err != nil {
+				return nil, err
+			}
+			query.where(field, "$gte", from)
+		}
+		if condition.To != "" {
+			to, date, err := normalizeLedgerDate(condition.To)
+			if err != nil {
+				return nil, err
+			}
+			if isCalendarDate(condition.To) {
+				query.where(field, "$lt", formatLedgerTime(date.AddDate(0, 0, 1)))
+			} else {
+				query.where(field, "$lte", to)
+			}
+		}
+		if condition.Prefix != nil {
+			// a key range rather than $regex, so the prefix is never interpreted as a pattern
+			query.where(field, "$gte", *condition.Prefix)
+			query.where(field, "$lt", *condition.Prefix+"\uffff")
+		}
+	}
+
+	return query, nil
+}
+
+// containsString returns true when values contains value
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// productSearchQueryString marshals the search selector, sorted as requested by "Field", "Field:asc"
+// or "Field:desc"; an empty sort leaves the results in key order
+func productSearchQueryString(query selector, sort string) (string, error) {
+	if sort == "" {
+		return query.queryString()
+	}
+
+	field, direction := sort, "asc"
+	if separator := strings.LastIndex(sort, ":"); separator >= 0 {
+		field, direction = sort[:separator], sort[separator+1:]
+	}
+	if !productSortFields[field] {
+		return "", ledgerErrorf(ErrValidationFailed, "products cannot be sorted by %s", field)
+	}
+	if direction != "asc" && direction != "desc" {
+		return "", ledgerErrorf(ErrValidationFailed, "the sort direction must be asc or desc, not %s", direction)
+	}
+
+	// CouchDB only picks the sort index when the selector constrains the sorted field
+	if _, ok := query[field]; !ok {
+		query.greaterThan(field, nil)
+	}
+
+	return query.sortedQueryString(direction, "DocType", field)
+}
+
+// SearchProducts returns one page of the products matching a filter such as
+// {"ProductType":{"eq":"cosmetics"},"ProductFactoryID":{"in":["f1","f2"]},
+// "ProductManufacturingDate":{"from":"2020-01-01","to":"2020-06-30"},"ProductName":{"prefix":"Soap"}}.
+// Conditions on different fields must all hold, and a date-only "to" includes the whole of that day.
+// Paginated queries are only supported in read-only transactions.
+func (s *SmartContract) SearchProducts(ctx contractapi.TransactionContextInterface,
+	filterJSON string, sort string, pageSize int32, bookmark string) (*PaginatedProductQueryResult, error) {
+
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := compileProductFilter(filterJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString, err := productSearchQueryString(query, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	products, err := constructProductQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedProductQueryResult{
+		Records:      products,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchProducts(t *testing.T) {
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{}, "Org1MSP", "alice")
+	chaincodeStub.GetQueryResultWithPaginationReturns(&mocks.StateQueryIterator{}, &peer.QueryResponseMetadata{Bookmark: "next"}, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	page, err := goodsLedger.SearchProducts(transactionContext, `{
+		"ProductType": {"eq": "cosmetics"},
+		"ProductFactoryID": {"in": ["factory1", "factory2"]},
+		"ProductManufacturingDate": {"from": "2020-01-01", "to": "2020-06-30"},
+		"ProductName": {"prefix": "Soap"}
+	}`, "ProductManufacturingDate:desc", 10, "")
+	require.NoError(t, err)
+	require.Equal(t, "next", page.Bookmark)
+
+	var query struct {
+		Selector map[string]interface{}   `json:"selector"`
+		Sort     []map[string]interface{} `json:"sort"`
+	}
+	queryString, _, _ := chaincodeStub.GetQueryResultWithPaginationArgsForCall(0)
+	require.NoError(t, json.Unmarshal([]byte(queryString), &query))
+	require.Equal(t, map[string]interface{}{
+		"DocType":                  "product",
+		"ProductType":              map[string]interface{}{"$eq": "cosmetics"},
+		"ProductFactoryID":         map[string]interface{}{"$in": []interface{}{"factory1", "factory2"}},
+		"ProductManufacturingDate": map[string]interface{}{"$gte": "2020-01-01T00:00:00Z", "$lt": "2020-07-01T00:00:00Z"},
+		"ProductName":              map[string]interface{}{"$gte": "Soap", "$lt": "Soap\uffff"},
+	}, query.Selector)
+	require.Equal(t, []map[string]interface{}{{"DocType": "desc"}, {"ProductManufacturingDate": "desc"}}, query.Sort)
+
+	_, err = goodsLedger.SearchProducts(transactionContext, "", "ProductName", 10, "")
+	require.NoError(t, err)
+	queryString, _, _ = chaincodeStub.GetQueryResultWithPaginationArgsForCall(1)
+	require.NoError(t, json.Unmarshal([]byte(queryString), &query))
+	require.Equal(t, map[string]interface{}{"$gt": nil}, query.Selector["ProductName"])
+
+	// an upper bound with a time of day stays inclusive of that instant
+	_, err = goodsLedger.SearchProducts(transactionContext, `{"ProductExpiryDate": {"to": "2020-12-31T18:00:00+06:00"}}`, "", 10, "")
+	require.NoError(t, err)
+	queryString, _, _ = chaincodeStub.GetQueryResultWithPaginationArgsForCall(2)
+	require.NoError(t, json.Unmarshal([]byte(queryString), &query))
+	require.Equal(t, map[string]interface{}{"$lte": "2020-12-31T12:00:00Z"}, query.Selector["ProductExpiryDate"])
+
+	for _, filter := range []string{
+		`{"DocType": {"eq": "account"}}`,
+		`{"ProductType": {"$ne": "cosmetics"}}`,
+		`{"ProductType": {"prefix": "cos"}}`,
+		`{"ProductExpiryDate": {"eq": "2020-01-01"}}`,
+		`{"ProductExpiryDate": {"from": "soon"}}`,
+		`{"ProductType": {"in": []}}`,
+		`{"ProductType": {}}`,
+		`not json`,
+	} {
+		_, err = goodsLedger.SearchProducts(transactionContext, filter, "", 10, "")
+		requireErrorCode(t, err, chaincode.ErrValidationFailed)
+	}
+
+	_, err = goodsLedger.SearchProducts(transactionContext, "", "ProductOwnerAccountID", 10, "")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	_, err = goodsLedger.SearchProducts(transactionContext, "", "ProductName:up", 10, "")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+}
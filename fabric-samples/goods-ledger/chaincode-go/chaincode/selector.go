@@ -0,0 +1,67 @@
+package chaincode
+
+import (
+	"encoding/json"
+)
+
+// selector is a CouchDB Mango selector. Values are only ever marshalled with encoding/json,
+// so quotes or operators in client input cannot change the shape of the query.
+type selector map[string]interface{}
+
+// newSelector returns a selector matching documents of the given DocType
+func newSelector(docType string) selector {
+	return selector{"DocType": docType}
+}
+
+// where adds a condition with the given Mango operator on the field, next to any other conditions on it
+func (query selector) where(field string, operator string, value interface{}) selector {
+	conditions, ok := query[field].(map[string]interface{})
+	if !ok {
+		conditions = map[string]interface{}{}
+		query[field] = conditions
+	}
+	conditions[operator] = value
+
+	return query
+}
+
+// equals adds an equality condition on the given field
+func (query selector) equals(field string, value interface{}) selector {
+	return query.where(field, "$eq", value)
+}
+
+// greaterThan adds a condition that the given field sorts after value
+func (query selector) greaterThan(field string, value interface{}) selector {
+	return query.where(field, "$gt", value)
+}
+
+// lessThan adds a condition that the given field sorts before value
+func (query selector) lessThan(field string, value interface{}) selector {
+	return query.where(field, "$lt", value)
+}
+
+// queryString marshals the selector into a CouchDB query
+func (query selector) queryString() (string, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": query})
+	if err != nil {
+		return "", err
+	}
+
+	return string(queryBytes), nil
+}
+
+// sortedQueryString marshals the selector into a CouchDB query whose results are sorted by the given fields.
+// CouchDB only sorts on fields covered by an index, see META-INF/statedb/couchdb/indexes.
+func (query selector) sortedQueryString(direction string, fields ...string) (string, error) {
+	sort := make([]map[string]string, 0, len(fields))
+	for _, field := range fields {
+		sort = append(sort, map[string]string{field: direction})
+	}
+
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": query, "sort": sort})
+	if err != nil {
+		return "", err
+	}
+
+	return string(queryBytes), nil
+}
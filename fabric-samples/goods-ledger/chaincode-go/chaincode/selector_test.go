@@ -0,0 +1,33 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuerySelectorEscapesInput(t *testing.T) {
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{}, "Org1MSP", "alice")
+	chaincodeStub.GetQueryResultWithPaginationReturns(&mocks.StateQueryIterator{}, &peer.QueryResponseMetadata{}, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	injection := `x", "DocType": {"$gt": null}, "x": "`
+	filter, err := json.Marshal(map[string]interface{}{"ProductType": map[string]string{"eq": injection}})
+	require.NoError(t, err)
+	_, err = goodsLedger.SearchProducts(transactionContext, string(filter), "", 10, "")
+	require.NoError(t, err)
+
+	var query struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	queryString, _, _ := chaincodeStub.GetQueryResultWithPaginationArgsForCall(0)
+	require.NoError(t, json.Unmarshal([]byte(queryString), &query))
+	require.Equal(t, map[string]interface{}{
+		"DocType":     "product",
+		"ProductType": map[string]interface{}{"$eq": injection},
+	}, query.Selector)
+}
@@ -2,7 +2,6 @@ package chaincode
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
@@ -28,14 +27,13 @@ type Asset struct {
 ///////////////////////////////////////////////////////////////////////////////////////////////
 
 type Account struct {
-	AccountToken               string `json:"AccountToken"`
 	AccountType                string `json:"AccountType"`
-	AccountName                string `json:"AccountName"`
 	AccountUsername            string `json:"AccountUsername"`
-	AccountEmail               string `json:"AccountEmail"`
-	AccountPhoneNumber         string `json:"AccountPhoneNumber"`
-	AccountPassword            string `json:"AccountPassword"`
 	AccountOwnerManufacturerID string `json:"AccountOwnerManufacturerID"`
+	AccountMSPID               string `json:"AccountMSPID"`
+	AccountClientID            string `json:"AccountClientID"`
+	SchemaVersion              int    `json:"SchemaVersion"`
+	Version                    int    `json:"Version"`
 	DocType                    string `json:"DocType"`
 }
 
@@ -52,6 +50,15 @@ type Product struct {
 	ProductManufacturingLocation string `json:"ProductManufacturingLocation"`
 	ProductManufacturingDate     string `json:"ProductManufacturingDate"`
 	ProductExpiryDate            string `json:"ProductExpiryDate"`
+	ProductReportedStolen        bool   `json:"ProductReportedStolen"`
+	ProductRecallStatus          string `json:"ProductRecallStatus"`
+	ProductRecallID              string `json:"ProductRecallID"`
+	ProductRecallReason          string `json:"ProductRecallReason"`
+	ProductRecalledAt            string `json:"ProductRecalledAt"`
+	ProductUpdaterMSPID          string `json:"ProductUpdaterMSPID"`
+	ProductUpdaterClientID       string `json:"ProductUpdaterClientID"`
+	SchemaVersion                int    `json:"SchemaVersion"`
+	Version                      int    `json:"Version"`
 	DocType                      string `json:"DocType"`
 }
 
@@ -61,6 +68,8 @@ type Manufacturer struct {
 	ManufacturerTradeLicenceID string `json:"ManufacturerTradeLicenceID"`
 	ManufacturerLocation       string `json:"ManufacturerLocation"`
 	ManufacturerFoundingDate   string `json:"ManufacturerFoundingDate"`
+	SchemaVersion              int    `json:"SchemaVersion"`
+	Version                    int    `json:"Version"`
 	DocType                    string `json:"DocType"`
 }
 
@@ -69,6 +78,8 @@ type Factory struct {
 	FactoryID             string `json:"FactoryID"`
 	FactoryName           string `json:"FactoryName"`
 	FactoryLocation       string `json:"FactoryLocation"`
+	SchemaVersion         int    `json:"SchemaVersion"`
+	Version               int    `json:"Version"`
 	DocType               string `json:"DocType"`
 }
 
@@ -91,7 +102,7 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 
 		err = ctx.GetStub().PutState(asset.ID, assetJSON)
 		if err != nil {
-			return fmt.Errorf("failed to put to world state. %v", err)
+			return ledgerErrorf(ErrInternal, "failed to put to world state. %v", err)
 		}
 	}
 
@@ -105,7 +116,7 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 	if exists {
-		return fmt.Errorf("the asset %s already exists", id)
+		return ledgerErrorf(ErrAlreadyExists, "the asset %s already exists", id)
 	}
 
 	asset := Asset{
@@ -120,17 +131,22 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+	err = ctx.GetStub().PutState(id, assetJSON)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to put to world state. %v", err)
+	}
+
+	return nil
 }
 
 // ReadAsset returns the asset stored in the world state with given id.
 func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
 	assetJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, ledgerErrorf(ErrInternal, "failed to read from world state: %v", err)
 	}
 	if assetJSON == nil {
-		return nil, fmt.Errorf("the asset %s does not exist", id)
+		return nil, ledgerErrorf(ErrNotFound, "the asset %s does not exist", id)
 	}
 
 	var asset Asset
@@ -149,7 +165,7 @@ func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
+		return ledgerErrorf(ErrNotFound, "the asset %s does not exist", id)
 	}
 
 	// overwriting original asset with new asset
@@ -165,7 +181,12 @@ func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+	err = ctx.GetStub().PutState(id, assetJSON)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to put to world state. %v", err)
+	}
+
+	return nil
 }
 
 // DeleteAsset deletes an given asset from the world state.
@@ -175,17 +196,22 @@ func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
+		return ledgerErrorf(ErrNotFound, "the asset %s does not exist", id)
 	}
 
-	return ctx.GetStub().DelState(id)
+	err = ctx.GetStub().DelState(id)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to delete from world state. %v", err)
+	}
+
+	return nil
 }
 
 // AssetExists returns true when asset with given ID exists in world state
 func (s *SmartContract) AssetExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
 	assetJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return false, ledgerErrorf(ErrInternal, "failed to read from world state: %v", err)
 	}
 
 	return assetJSON != nil, nil
@@ -204,7 +230,12 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, assetJSON)
+	err = ctx.GetStub().PutState(id, assetJSON)
+	if err != nil {
+		return ledgerErrorf(ErrInternal, "failed to put to world state. %v", err)
+	}
+
+	return nil
 }
 
 // GetAllAssets returns all assets found in world state
@@ -213,21 +244,29 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 	// open-ended query of all assets in the chaincode namespace.
 	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
 	if err != nil {
-		return nil, err
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
 	}
 	defer resultsIterator.Close()
 
+	return constructAssetQueryResponseFromIterator(resultsIterator)
+}
+
+// constructAssetQueryResponseFromIterator collects the assets of a range query, up to maxUnpagedQueryResults
+func constructAssetQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Asset, error) {
 	var assets []*Asset
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(assets) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d assets, use GetAllAssetsWithPagination", maxUnpagedQueryResults)
 		}
 
 		var asset Asset
 		err = json.Unmarshal(queryResponse.Value, &asset)
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResponse.Key, err)
 		}
 		assets = append(assets, &asset)
 	}
@@ -240,524 +279,464 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 //////////////////////////////////////////////////////////////////////////////////////////////
 
 func (s *SmartContract) RegisterAccount(ctx contractapi.TransactionContextInterface,
-	accountKey string, accountToken string, accountType string, accountName string, accountUsername string,
-	accountEmail string, accountPassword string, accountOwnerManufacturerID string, docType string) error {
+	accountType string, accountUsername string, accountOwnerManufacturerID string, docType string) (string, error) {
+
+	err := requireDocType(docType, accountObjectType)
+
+	if err != nil {
+		return "", err
+	}
 
-	account := Account {
-		AccountToken:               accountToken,
+	return s.CreateAccount(ctx, AccountInput {
 		AccountType:                accountType,
-		AccountName:                accountName,
 		AccountUsername:            accountUsername,
-		AccountEmail:               accountEmail,
-		AccountPassword:            accountPassword,
 		AccountOwnerManufacturerID: accountOwnerManufacturerID,
-		DocType:                    docType,
-	}
+	})
+}
 
-	accountAsBytes, err := json.Marshal(account)
+func (s *SmartContract) AddManufacturer(ctx contractapi.TransactionContextInterface,
+	manufacturerAccountID string, manufacturerName string, manufacturerTradeLicenceID string,
+	manufacturerLocation string, manufacturerFoundingDate string, docType string) (string, error) {
+
+	err := requireDocType(docType, manufacturerObjectType)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return ctx.GetStub().PutState(accountKey, accountAsBytes)
+	return s.CreateManufacturer(ctx, ManufacturerInput {
+		ManufacturerAccountID: manufacturerAccountID,
+		ManufacturerDetails:   ManufacturerDetails {
+			ManufacturerName:           manufacturerName,
+			ManufacturerTradeLicenceID: manufacturerTradeLicenceID,
+			ManufacturerLocation:       manufacturerLocation,
+			ManufacturerFoundingDate:   manufacturerFoundingDate,
+		},
+	})
 }
 
-func (s *SmartContract) AddManufacturer(ctx contractapi.TransactionContextInterface,
-	manufacturerAccountID string, manufacturerKey string, manufacturerName string, manufacturerTradeLicenceID string,
-	manufacturerLocation string, manufacturerFoundingDate string, docType string) error {
+func (s *SmartContract) AddFactory(ctx contractapi.TransactionContextInterface,
+	factoryManufacturerID string, factoryID string, factoryName string, factoryLocation string,
+	docType string) (string, error) {
 
-	manufacturer := Manufacturer {
-		ManufacturerAccountID:      manufacturerAccountID,
-		ManufacturerName:           manufacturerName,
-		ManufacturerTradeLicenceID: manufacturerTradeLicenceID,
-		ManufacturerLocation:       manufacturerLocation,
-		ManufacturerFoundingDate:   manufacturerFoundingDate,
-		DocType:                    docType,
+	err := requireDocType(docType, factoryObjectType)
+
+	if err != nil {
+		return "", err
 	}
 
-	manufacturerAsBytes, err := json.Marshal(manufacturer)
+	return s.CreateFactory(ctx, FactoryInput {
+		FactoryID:      factoryID,
+		FactoryDetails: FactoryDetails {
+			FactoryManufacturerID: factoryManufacturerID,
+			FactoryName:           factoryName,
+			FactoryLocation:       factoryLocation,
+		},
+	})
+}
+
+func (s *SmartContract) AddProduct(ctx contractapi.TransactionContextInterface,
+	productOwnerAccountID string, productManufacturerID string, productManufacturerName string, productFactoryID string,
+	productID string, productName string, productType string, productBatch string, productSerialinBatch string,
+	productManufacturingLocation string, productManufacturingDate string, productExpiryDate string, docType string) (string, error) {
+
+	err := requireDocType(docType, productObjectType)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return ctx.GetStub().PutState(manufacturerKey, manufacturerAsBytes)
+	return s.CreateProduct(ctx, ProductInput {
+		ProductManufacturerID:   productManufacturerID,
+		ProductManufacturerName: productManufacturerName,
+		ProductID:               productID,
+		ProductDetails:          ProductDetails {
+			ProductOwnerAccountID:        productOwnerAccountID,
+			ProductFactoryID:             productFactoryID,
+			ProductName:                  productName,
+			ProductType:                  productType,
+			ProductBatch:                 productBatch,
+			ProductSerialinBatch:         productSerialinBatch,
+			ProductManufacturingLocation: productManufacturingLocation,
+			ProductManufacturingDate:     productManufacturingDate,
+			ProductExpiryDate:            productExpiryDate,
+		},
+	})
 }
 
-func (s *SmartContract) AddFactory(ctx contractapi.TransactionContextInterface,
-	factoryKey string, factoryManufacturerID string, factoryID string, factoryName string, factoryLocation string,
-	docType string) error {
+func (s *SmartContract) UpdateProductOwner(ctx contractapi.TransactionContextInterface,
+	productKey string, productOwnerAccountID string, expectedVersion int) error {
 
-	factory := Factory {
-		FactoryManufacturerID: factoryManufacturerID,
-		FactoryID:             factoryID,
-		FactoryName:           factoryName,
-		FactoryLocation:       factoryLocation,
-		DocType:               docType,
+	product, err := readProduct(ctx, productKey)
+
+	if err != nil {
+		return err
 	}
 
-	factoryAsBytes, err := json.Marshal(factory)
+	err = requireVersion("product", productKey, product.Version, expectedVersion)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(factoryKey, factoryAsBytes)
-}
+	// moving a product between the submitter's own accounts needs no handshake
+	err = requireDirectTransfer(ctx, productKey, product, productOwnerAccountID)
 
-func (s *SmartContract) AddProduct(ctx contractapi.TransactionContextInterface,
-	productKey string, productOwnerAccountID string, productManufacturerID string, productManufacturerName string, productFactoryID string,
-	productID string, productName string, productType string, productBatch string, productSerialinBatch string,
-	productManufacturingLocation string, productManufacturingDate string, productExpiryDate string, docType string) error {
+	if err != nil {
+		return err
+	}
 
-	product := Product {
-		ProductOwnerAccountID:        productOwnerAccountID,
-		ProductManufacturerID:        productManufacturerID,
-		ProductManufacturerName:      productManufacturerName,
-		ProductFactoryID:             productFactoryID,
-		ProductID:                    productID,
-		ProductName:                  productName,
-		ProductType:                  productType,
-		ProductBatch:                 productBatch,
-		ProductSerialinBatch:         productSerialinBatch,
-		ProductManufacturingLocation: productManufacturingLocation,
-		ProductManufacturingDate:     productManufacturingDate,
-		ProductExpiryDate:            productExpiryDate,
-		DocType:                      docType,
+	previousOwnerAccountID := product.ProductOwnerAccountID
+	product.ProductOwnerAccountID = productOwnerAccountID
+
+	err = putProduct(ctx, productKey, product)
+
+	if err != nil {
+		return err
 	}
 
-	productAsBytes, err := json.Marshal(product)
+	err = deleteTransferOffer(ctx, productKey)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(productKey, productAsBytes)
+	return emitEvent(ctx, EventProductOwnerChanged, &LedgerEvent{
+		Key:               productKey,
+		DocType:           product.DocType,
+		ManufacturerID:    product.ProductManufacturerID,
+		OldOwnerAccountID: previousOwnerAccountID,
+		NewOwnerAccountID: productOwnerAccountID,
+	})
 }
 
-func (s *SmartContract) UpdateProductOwner(ctx contractapi.TransactionContextInterface,
-	productKey string, productOwnerAccountID string) error {
+func (s *SmartContract) SetProductReportedStolen(ctx contractapi.TransactionContextInterface,
+	productKey string, reportedStolen bool) error {
 
-	productAsBytes, err := ctx.GetStub().GetState(productKey)
+	product, err := readProduct(ctx, productKey)
 
 	if err != nil {
 		return err
 	}
 
-	product := Product{}
+	_, err = requireAccountOwner(ctx, product.ProductOwnerAccountID)
 
-	json.Unmarshal(productAsBytes, &product)
-	product.ProductOwnerAccountID = productOwnerAccountID
+	if err != nil {
+		return rephraseUnauthorized(err, "the submitting identity does not own product %s", productKey)
+	}
+
+	product.ProductReportedStolen = reportedStolen
 
-	productAsBytes, err = json.Marshal(product)
+	err = putProduct(ctx, productKey, product)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(productKey, productAsBytes)
+	return emitEvent(ctx, EventProductReportedStolen, &LedgerEvent{
+		Key:               productKey,
+		DocType:           product.DocType,
+		ManufacturerID:    product.ProductManufacturerID,
+		NewOwnerAccountID: product.ProductOwnerAccountID,
+	})
 }
 
 func (s *SmartContract) UpdateAccountOwnerManufacturerID(ctx contractapi.TransactionContextInterface,
-	accountKey string, accountOwnerManufacturerID string) error {
+	accountKey string, accountOwnerManufacturerID string, expectedVersion int) error {
 
-	accountAsBytes, err := ctx.GetStub().GetState(accountKey)
+	account, err := requireAccountOwner(ctx, accountKey)
 
 	if err != nil {
 		return err
 	}
 
-	account := Account{}
-
-	json.Unmarshal(accountAsBytes, &account)
-	account.AccountOwnerManufacturerID = accountOwnerManufacturerID
-
-	accountAsBytes, err = json.Marshal(account)
+	err = requireVersion("account", accountKey, account.Version, expectedVersion)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(accountKey, accountAsBytes)
-}
+	if accountOwnerManufacturerID != "" {
+		err = requireReference(ctx, "manufacturer", accountOwnerManufacturerID)
 
-func (s *SmartContract) UpdateAccountToken(ctx contractapi.TransactionContextInterface,
-	accountKey string, accountToken string) error {
+		if err != nil {
+			return err
+		}
+	}
+
+	account.AccountOwnerManufacturerID = accountOwnerManufacturerID
+
+	account.SchemaVersion = currentSchemaVersion(accountObjectType)
+	account.Version++
+	accountAsBytes, err := json.Marshal(account)
 
-	accountAsBytes, err := ctx.GetStub().GetState(accountKey)
-	
 	if err != nil {
 		return err
 	}
-	
-	account := Account{}
-
-	json.Unmarshal(accountAsBytes, &account)
-	account.AccountToken = accountToken
 
-	accountAsBytes, err = json.Marshal(account)
+	err = putDocument(ctx, accountKey, accountAsBytes)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(accountKey, accountAsBytes)
+	return emitEvent(ctx, EventAccountUpdated, &LedgerEvent{
+		Key:            accountKey,
+		DocType:        account.DocType,
+		ManufacturerID: accountOwnerManufacturerID,
+	})
 }
 
-func (s *SmartContract) UpdateAccount(ctx contractapi.TransactionContextInterface,
-	accountKey string, accountToken string, accountName string, accountEmail string, accountPhoneNumber string) error {
+func (s *SmartContract) UpdateAccountToken(ctx contractapi.TransactionContextInterface,
+	accountKey string, expectedVersion int) error {
 
-	accountAsBytes, err := ctx.GetStub().GetState(accountKey)
+	account, err := requireAccountOwner(ctx, accountKey)
 
 	if err != nil {
 		return err
 	}
 
-	account := Account{}
-
-	json.Unmarshal(accountAsBytes, &account)
-	account.AccountToken = accountToken
-	account.AccountName = accountName
-	account.AccountEmail = accountEmail
-	account.AccountPhoneNumber = accountPhoneNumber
-
-	accountAsBytes, err = json.Marshal(account)
+	previous, err := readAccountSecret(ctx, implicitCollection(account.AccountMSPID), accountKey)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(accountKey, accountAsBytes)
-}
+	version := 0
+	if previous != nil {
+		version = previous.Version
+	}
 
-func (s *SmartContract) UpdateManufacturer(ctx contractapi.TransactionContextInterface,
-	manufacturerKey string, manufacturerName string, manufacturerTradeLicenceID string, manufacturerLocation string,
-	manufacturerFoundingDate string) error {
+	err = requireVersion("accountSecret", accountKey, version, expectedVersion)
 
-	manufacturerAsBytes, err := ctx.GetStub().GetState(manufacturerKey)
+	if err != nil {
+		return err
+	}
+
+	secret, err := getAccountSecretInput(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	manufacturer := Manufacturer{}
+	// the password is optional here, an empty one keeps the stored verifier
+	err = validationError(accountSecretValidations.only("AccountToken").check(secret))
 
-	json.Unmarshal(manufacturerAsBytes, &manufacturer)
-	manufacturer.ManufacturerName = manufacturerName
-	manufacturer.ManufacturerTradeLicenceID = manufacturerTradeLicenceID
-	manufacturer.ManufacturerLocation = manufacturerLocation
-	manufacturer.ManufacturerFoundingDate = manufacturerFoundingDate
+	if err != nil {
+		return err
+	}
 
-	manufacturerAsBytes, err = json.Marshal(manufacturer)
+	err = putAccountSecret(ctx, implicitCollection(account.AccountMSPID), accountKey, secret.AccountPassword, secret.AccountToken)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(manufacturerKey, manufacturerAsBytes)
+	return emitEvent(ctx, EventAccountCredentialsUpdated, &LedgerEvent{Key: accountKey, DocType: account.DocType})
 }
 
-func (s *SmartContract) UpdateFactory(ctx contractapi.TransactionContextInterface,
-	factoryKey string, factoryManufacturerID string, factoryName string, factoryLocation string) error {
+func (s *SmartContract) UpdateAccount(ctx contractapi.TransactionContextInterface,
+	accountKey string, expectedVersion int) error {
 
-	factoryAsBytes, err := ctx.GetStub().GetState(factoryKey)
+	account, err := requireAccountOwner(ctx, accountKey)
 
 	if err != nil {
 		return err
 	}
 
-	factory := Factory{}
-
-	json.Unmarshal(factoryAsBytes, &factory)
-	factory.FactoryManufacturerID = factoryManufacturerID
-	factory.FactoryName = factoryName
-	factory.FactoryLocation = factoryLocation
-
-	factoryAsBytes, err = json.Marshal(factory)
+	previous, err := readAccountDetails(ctx, implicitCollection(account.AccountMSPID), accountKey)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(factoryKey, factoryAsBytes)
-}
+	version := 0
+	if previous != nil {
+		version = previous.Version
+	}
 
-func (s *SmartContract) UpdateProduct(ctx contractapi.TransactionContextInterface,
-	productKey string, productOwnerAccountID string, productFactoryID string, productName string, productType string, productBatch string,
-	productSerialinBatch string, productManufacturingLocation string, productManufacturingDate string, productExpiryDate string) error {
+	err = requireVersion("accountDetails", accountKey, version, expectedVersion)
 
-	productAsBytes, err := ctx.GetStub().GetState(productKey)
+	if err != nil {
+		return err
+	}
+
+	details, err := getAccountDetailsInput(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	product := Product{}
+	err = validationError(accountDetailsValidations.check(details))
 
-	json.Unmarshal(productAsBytes, &product)
-	product.ProductOwnerAccountID = productOwnerAccountID
-	product.ProductFactoryID = productFactoryID
-	product.ProductName = productName
-	product.ProductType = productType
-	product.ProductBatch = productBatch
-	product.ProductSerialinBatch = productSerialinBatch
-	product.ProductManufacturingLocation = productManufacturingLocation
-	product.ProductManufacturingDate = productManufacturingDate
-	product.ProductExpiryDate = productExpiryDate
+	if err != nil {
+		return err
+	}
 
-	productAsBytes, err = json.Marshal(product)
+	err = putAccountDetails(ctx, implicitCollection(account.AccountMSPID), accountKey, details)
 
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(productKey, productAsBytes)
+	return emitEvent(ctx, EventAccountDetailsUpdated, &LedgerEvent{Key: accountKey, DocType: account.DocType})
+}
+
+func (s *SmartContract) UpdateManufacturer(ctx contractapi.TransactionContextInterface,
+	manufacturerKey string, manufacturerName string, manufacturerTradeLicenceID string, manufacturerLocation string,
+	manufacturerFoundingDate string, expectedVersion int) error {
+
+	return s.UpdateManufacturerDetails(ctx, manufacturerKey, ManufacturerDetails {
+		ManufacturerName:           manufacturerName,
+		ManufacturerTradeLicenceID: manufacturerTradeLicenceID,
+		ManufacturerLocation:       manufacturerLocation,
+		ManufacturerFoundingDate:   manufacturerFoundingDate,
+	}, expectedVersion)
+}
+
+func (s *SmartContract) UpdateFactory(ctx contractapi.TransactionContextInterface,
+	factoryKey string, factoryManufacturerID string, factoryName string, factoryLocation string, expectedVersion int) error {
+
+	return s.UpdateFactoryDetails(ctx, factoryKey, FactoryDetails {
+		FactoryManufacturerID: factoryManufacturerID,
+		FactoryName:           factoryName,
+		FactoryLocation:       factoryLocation,
+	}, expectedVersion)
+}
+
+func (s *SmartContract) UpdateProduct(ctx contractapi.TransactionContextInterface,
+	productKey string, productOwnerAccountID string, productFactoryID string, productName string, productType string, productBatch string,
+	productSerialinBatch string, productManufacturingLocation string, productManufacturingDate string, productExpiryDate string,
+	expectedVersion int) error {
+
+	return s.UpdateProductDetails(ctx, productKey, ProductDetails {
+		ProductOwnerAccountID:        productOwnerAccountID,
+		ProductFactoryID:             productFactoryID,
+		ProductName:                  productName,
+		ProductType:                  productType,
+		ProductBatch:                 productBatch,
+		ProductSerialinBatch:         productSerialinBatch,
+		ProductManufacturingLocation: productManufacturingLocation,
+		ProductManufacturingDate:     productManufacturingDate,
+		ProductExpiryDate:            productExpiryDate,
+	}, expectedVersion)
 }
 
 func (s *SmartContract) QueryAccountbyToken(ctx contractapi.TransactionContextInterface,
 	accountToken string) ([]*Account, error) {
-	
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"account",
-				"AccountToken":"%s"
-			}
-		}`,
-		accountToken,
-	)
-	
-	return getAccountQueryResultForQueryString(ctx, queryString)
+
+	// tokens are only stored as hashes in the private data collection of the owning organization
+	return queryAccountByPrivateIndex(ctx, accountTokenIndex, hashAccountToken(accountToken))
 }
 
 func (s *SmartContract) QueryAccountbyEmail(ctx contractapi.TransactionContextInterface,
 	accountEmail string) ([]*Account, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"account",
-				"AccountEmail":"%s"
-			}
-		}`,
-		accountEmail,
-	)
-	
-	return getAccountQueryResultForQueryString(ctx, queryString)
+	// emails are only stored in the private data collection of the owning organization, looked up by hash
+	return queryAccountByPrivateIndex(ctx, accountEmailIndex, hashAccountEmail(accountEmail))
 }
 
 func (s *SmartContract) QueryAccountbyUsername(ctx contractapi.TransactionContextInterface,
 	accountUsername string) ([]*Account, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"account",
-				"AccountUsername":"%s"
-			}
-		}`,
-		accountUsername,
-	)
-	
-	return getAccountQueryResultForQueryString(ctx, queryString)
+	return getAccountQueryResultForIndex(ctx, accountByUsernameIndex, accountUsername)
 }
 
 func (s *SmartContract) QueryManufacturerbyAccountID(ctx contractapi.TransactionContextInterface,
 	manufacturerAccountID string) ([]*Manufacturer, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"manufacturer",
-				"ManufacturerAccountID":"%s"
-			}
-		}`,
-		manufacturerAccountID,
-	)
-
-	return getManufacturerQueryResultForQueryString(ctx, queryString)
+	return getManufacturerQueryResultForIndex(ctx, manufacturerByAccountIndex, manufacturerAccountID)
 }
 
 func (s *SmartContract) QueryManufacturerbyTradeLicenceID(ctx contractapi.TransactionContextInterface,
 	manufacturerTradeLicenceID string) ([]*Manufacturer, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"manufacturer",
-				"ManufacturerTradeLicenceID":"%s"
-			}
-		}`,
-		manufacturerTradeLicenceID,
-	)
-
-	return getManufacturerQueryResultForQueryString(ctx, queryString)
+	return getManufacturerQueryResultForIndex(ctx, manufacturerByTradeLicenceIndex, manufacturerTradeLicenceID)
 }
 
 func (s *SmartContract) QueryFactorybyID(ctx contractapi.TransactionContextInterface,
 	factoryID string) ([]*Factory, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"factory",
-				"FactoryID":"%s"
-			}
-		}`,
-		factoryID,
-	)
-
-	return getFactoryQueryResultForQueryString(ctx, queryString)
+	return getFactoryQueryResultForIndex(ctx, factoryByIDIndex, factoryID)
 }
 
 func (s *SmartContract) QueryFactorybyManufacturerID(ctx contractapi.TransactionContextInterface,
 	factoryManufacturerID string) ([]*Factory, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"factory",
-				"FactoryManufacturerID":"%s"
-			}
-		}`,
-		factoryManufacturerID,
-	)
-
-	return getFactoryQueryResultForQueryString(ctx, queryString)
+	return getFactoryQueryResultForIndex(ctx, factoryByManufacturerIndex, factoryManufacturerID)
 }
 
 func (s *SmartContract) QueryProductbyID(ctx contractapi.TransactionContextInterface,
 	productID string) ([]*Product, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"product",
-				"ProductID":"%s"
-			}
-		}`,
-		productID,
-	)
-
-	return getProductQueryResultForQueryString(ctx, queryString)
+	return getProductQueryResultForIndex(ctx, productByIDIndex, productID)
 }
 
 func (s *SmartContract) QueryProductbyCode(ctx contractapi.TransactionContextInterface,
 	productCode string) ([]*Product, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"product",
-				"_id":"%s"
-			}
-		}`,
-		productCode,
-	)
+	// the product code is the product key, so it is read directly rather than queried
+	var product Product
+	exists, err := readDocument(ctx, productCode, &product)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists || product.DocType != productObjectType {
+		return nil, nil
+	}
 
-	return getProductQueryResultForQueryString(ctx, queryString)
+	return []*Product{&product}, nil
 }
 
 func (s *SmartContract) QueryProductbyOwnerAccountID(ctx contractapi.TransactionContextInterface,
 	productOwnerAccountID string) ([]*Product, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"product",
-				"ProductOwnerAccountID":"%s"
-			}
-		}`,
-		productOwnerAccountID,
-	)
-
-	return getProductQueryResultForQueryString(ctx, queryString)
+	return getProductQueryResultForIndex(ctx, productByOwnerIndex, productOwnerAccountID)
 }
 
 func (s *SmartContract) QueryProductbyManufacturerID(ctx contractapi.TransactionContextInterface,
 	productManufacturerID string) ([]*Product, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"product",
-				"ProductManufacturerID":"%s"
-			}
-		}`,
-		productManufacturerID,
-	)
-
-	return getProductQueryResultForQueryString(ctx, queryString)
+	return getProductQueryResultForIndex(ctx, productByManufacturerIndex, productManufacturerID)
 }
 
 func (s *SmartContract) QueryProductbyFactoryID(ctx contractapi.TransactionContextInterface,
 	productFactoryID string) ([]*Product, error) {
 
-	var queryString = fmt.Sprintf(
-		`{
-			"selector":{
-				"DocType":"product",
-				"ProductFactoryID":"%s"
-			}
-		}`,
-		productFactoryID,
-	)
-
-	return getProductQueryResultForQueryString(ctx, queryString)
+	return getProductQueryResultForIndex(ctx, productByFactoryIndex, productFactoryID)
 }
 
-func getAccountQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Account, error) {
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+func getProductQueryResultForSelector(ctx contractapi.TransactionContextInterface, query selector) ([]*Product, error) {
+	queryString, err := query.queryString()
 	if err != nil {
 		return nil, err
 	}
-	defer resultsIterator.Close()
 
-	return constructAccountQueryResponseFromIterator(resultsIterator)
-}
-
-func getProductQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Product, error) {
 	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
 	if err != nil {
-		return nil, err
+		return nil, ledgerErrorf(ErrInternal, "failed to query world state: %v", err)
 	}
 	defer resultsIterator.Close()
 
 	return constructProductQueryResponseFromIterator(resultsIterator)
 }
 
-func getManufacturerQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Manufacturer, error) {
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
-	if err != nil {
-		return nil, err
-	}
-	defer resultsIterator.Close()
-
-	return constructManufacturerQueryResponseFromIterator(resultsIterator)
-}
-
-func getFactoryQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Factory, error) {
-	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
-	if err != nil {
-		return nil, err
-	}
-	defer resultsIterator.Close()
-
-	return constructFactoryQueryResponseFromIterator(resultsIterator)
-}
-
 func constructAccountQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Account, error) {
 	var accounts []*Account
 	for resultsIterator.HasNext() {
 		queryResult, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(accounts) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d accounts, use its paginated variant", maxUnpagedQueryResults)
 		}
 		var account Account
 		err = json.Unmarshal(queryResult.Value, &account)
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
 		}
 		accounts = append(accounts, &account)
 	}
@@ -770,12 +749,15 @@ func constructProductQueryResponseFromIterator(resultsIterator shim.StateQueryIt
 	for resultsIterator.HasNext() {
 		queryResult, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(products) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d products, use its paginated variant", maxUnpagedQueryResults)
 		}
 		var product Product
 		err = json.Unmarshal(queryResult.Value, &product)
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
 		}
 		products = append(products, &product)
 	}
@@ -788,12 +770,15 @@ func constructManufacturerQueryResponseFromIterator(resultsIterator shim.StateQu
 	for resultsIterator.HasNext() {
 		queryResult, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(manufacturers) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d manufacturers, use its paginated variant", maxUnpagedQueryResults)
 		}
 		var manufacturer Manufacturer
 		err = json.Unmarshal(queryResult.Value, &manufacturer)
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
 		}
 		manufacturers = append(manufacturers, &manufacturer)
 	}
@@ -806,15 +791,118 @@ func constructFactoryQueryResponseFromIterator(resultsIterator shim.StateQueryIt
 	for resultsIterator.HasNext() {
 		queryResult, err := resultsIterator.Next()
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(factories) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d factories, use its paginated variant", maxUnpagedQueryResults)
 		}
 		var factory Factory
 		err = json.Unmarshal(queryResult.Value, &factory)
 		if err != nil {
-			return nil, err
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
 		}
 		factories = append(factories, &factory)
 	}
 
 	return factories, nil
-}
\ No newline at end of file
+}
+
+// readDocument unmarshals the world state value with given key into document and reports whether it exists.
+func readDocument(ctx contractapi.TransactionContextInterface, key string, document interface{}) (bool, error) {
+	documentAsBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, ledgerErrorf(ErrInternal, "failed to read from world state: %v", err)
+	}
+	if documentAsBytes == nil {
+		return false, nil
+	}
+
+	// documents not migrated yet are upgraded on the fly, so updates write them back at the current schema version
+	documentAsBytes, _, err = upgradeDocument(documentAsBytes)
+	if err != nil {
+		return false, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", key, err)
+	}
+
+	err = json.Unmarshal(documentAsBytes, document)
+	if err != nil {
+		return false, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", key, err)
+	}
+
+	return true, nil
+}
+
+// readAccount returns the account stored in the world state with given key.
+func readAccount(ctx contractapi.TransactionContextInterface, accountKey string) (*Account, error) {
+	var account Account
+	exists, err := readDocument(ctx, accountKey, &account)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || account.DocType != accountObjectType {
+		return nil, ledgerErrorf(ErrNotFound, "the account %s does not exist", accountKey)
+	}
+
+	return &account, nil
+}
+
+// readManufacturer returns the manufacturer stored in the world state with given key.
+func readManufacturer(ctx contractapi.TransactionContextInterface, manufacturerKey string) (*Manufacturer, error) {
+	var manufacturer Manufacturer
+	exists, err := readDocument(ctx, manufacturerKey, &manufacturer)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || manufacturer.DocType != manufacturerObjectType {
+		return nil, ledgerErrorf(ErrNotFound, "the manufacturer %s does not exist", manufacturerKey)
+	}
+
+	return &manufacturer, nil
+}
+
+// readFactory returns the factory stored in the world state with given key.
+func readFactory(ctx contractapi.TransactionContextInterface, factoryKey string) (*Factory, error) {
+	var factory Factory
+	exists, err := readDocument(ctx, factoryKey, &factory)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || factory.DocType != factoryObjectType {
+		return nil, ledgerErrorf(ErrNotFound, "the factory %s does not exist", factoryKey)
+	}
+
+	return &factory, nil
+}
+
+// readProduct returns the product stored in the world state with given key.
+func readProduct(ctx contractapi.TransactionContextInterface, productKey string) (*Product, error) {
+	var product Product
+	exists, err := readDocument(ctx, productKey, &product)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || product.DocType != productObjectType {
+		return nil, ledgerErrorf(ErrNotFound, "the product %s does not exist", productKey)
+	}
+
+	return &product, nil
+}
+
+// putProduct stamps the product with the submitting identity and writes it to the world state.
+func putProduct(ctx contractapi.TransactionContextInterface, productKey string, product *Product) error {
+	caller, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	product.SchemaVersion = currentSchemaVersion(productObjectType)
+	product.Version++
+	product.ProductUpdaterMSPID = caller.mspID
+	product.ProductUpdaterClientID = caller.clientID
+
+	productAsBytes, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+
+	return putDocument(ctx, productKey, productAsBytes)
+}
@@ -0,0 +1,378 @@
+package chaincode
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TransferOffer is a pending handover of a product that the recipient still has to accept
+type TransferOffer struct {
+	ProductKey    string `json:"ProductKey"`
+	FromAccountID string `json:"FromAccountID"`
+	ToAccountID   string `json:"ToAccountID"`
+	OfferedAt     string `json:"OfferedAt"`
+	ExpiresAt     string `json:"ExpiresAt"`
+	SchemaVersion int    `json:"SchemaVersion"`
+	Version       int    `json:"Version"`
+	DocType       string `json:"DocType"`
+}
+
+// OfferProductTransfer offers the product to another account. The offer replaces any pending one for the product
+// and lapses at expiresAt unless the recipient accepts it with AcceptProductTransfer.
+func (s *SmartContract) OfferProductTransfer(ctx contractapi.TransactionContextInterface,
+	productKey string, toAccountID string, expiresAt string) error {
+
+	err := validationError(transferOfferValidations.check(&TransferOffer{
+		ProductKey:  productKey,
+		ToAccountID: toAccountID,
+		ExpiresAt:   expiresAt,
+	}))
+	if err != nil {
+		return err
+	}
+
+	product, err := readProduct(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = requireAccountOwner(ctx, product.ProductOwnerAccountID)
+	if err != nil {
+		return rephraseUnauthorized(err, "the submitting identity does not own product %s", productKey)
+	}
+
+	err = requireTransferable(ctx, productKey, product)
+	if err != nil {
+		return err
+	}
+
+	err = requireReference(ctx, "account", toAccountID)
+	if err != nil {
+		return err
+	}
+	if toAccountID == product.ProductOwnerAccountID {
+		return ledgerErrorf(ErrValidationFailed, "the product %s is already owned by account %s", productKey, toAccountID)
+	}
+
+	expiry, err := parseLedgerDate(expiresAt)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !expiry.After(txTime) {
+		return ledgerErrorf(ErrValidationFailed, "the offer expiry %s is not in the future", expiresAt)
+	}
+
+	offer := TransferOffer{
+		ProductKey:    productKey,
+		FromAccountID: product.ProductOwnerAccountID,
+		ToAccountID:   toAccountID,
+		OfferedAt:     formatLedgerTime(txTime),
+		ExpiresAt:     formatLedgerTime(expiry),
+		SchemaVersion: currentSchemaVersion(transferOfferObjectType),
+		Version:       1,
+		DocType:       transferOfferObjectType,
+	}
+	offerAsBytes, err := json.Marshal(offer)
+	if err != nil {
+		return err
+	}
+
+	offerKey, err := transferOfferKey(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	err = putDocument(ctx, offerKey, offerAsBytes)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventProductTransferOffered, &LedgerEvent{
+		Key:               productKey,
+		DocType:           product.DocType,
+		ManufacturerID:    product.ProductManufacturerID,
+		OldOwnerAccountID: offer.FromAccountID,
+		NewOwnerAccountID: offer.ToAccountID,
+	})
+}
+
+// AcceptProductTransfer completes the pending offer of the product. Only the recipient can accept, and only
+// before the offer expires.
+func (s *SmartContract) AcceptProductTransfer(ctx contractapi.TransactionContextInterface, productKey string) error {
+	offer, err := readTransferOffer(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = requireAccountOwner(ctx, offer.ToAccountID)
+	if err != nil {
+		return rephraseUnauthorized(err, "the transfer offer for product %s is not addressed to the submitting identity", productKey)
+	}
+
+	expiry, err := parseLedgerDate(offer.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !expiry.After(txTime) {
+		return ledgerErrorf(ErrExpired, "the transfer offer for product %s expired at %s", productKey, offer.ExpiresAt)
+	}
+
+	product, err := readProduct(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	// the offer only holds while the offering account still owns the product
+	if product.ProductOwnerAccountID != offer.FromAccountID {
+		return ledgerErrorf(ErrConflict, "the transfer offer for product %s is no longer valid", productKey)
+	}
+
+	err = requireTransferable(ctx, productKey, product)
+	if err != nil {
+		return err
+	}
+
+	product.ProductOwnerAccountID = offer.ToAccountID
+	err = putProduct(ctx, productKey, product)
+	if err != nil {
+		return err
+	}
+
+	err = deleteTransferOffer(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventProductOwnerChanged, &LedgerEvent{
+		Key:               productKey,
+		DocType:           product.DocType,
+		ManufacturerID:    product.ProductManufacturerID,
+		OldOwnerAccountID: offer.FromAccountID,
+		NewOwnerAccountID: offer.ToAccountID,
+	})
+}
+
+// CancelProductTransfer withdraws or declines the pending offer of the product. Either party can cancel,
+// including after the offer expired.
+func (s *SmartContract) CancelProductTransfer(ctx contractapi.TransactionContextInterface, productKey string) error {
+	offer, err := readTransferOffer(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = requireAccountOwner(ctx, offer.FromAccountID)
+	if ErrorCodeOf(err) == ErrUnauthorized {
+		_, err = requireAccountOwner(ctx, offer.ToAccountID)
+	}
+	if err != nil {
+		return rephraseUnauthorized(err, "the submitting identity is not a party to the transfer offer for product %s", productKey)
+	}
+
+	err = deleteTransferOffer(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventProductTransferCancelled, &LedgerEvent{
+		Key:               productKey,
+		DocType:           transferOfferObjectType,
+		OldOwnerAccountID: offer.FromAccountID,
+		NewOwnerAccountID: offer.ToAccountID,
+	})
+}
+
+// ReadTransferOffer returns the pending transfer offer of the product
+func (s *SmartContract) ReadTransferOffer(ctx contractapi.TransactionContextInterface, productKey string) (*TransferOffer, error) {
+	return readTransferOffer(ctx, productKey)
+}
+
+// QueryTransferOfferbyToAccountID returns the unexpired offers addressed to the account, its inbox of incoming transfers
+func (s *SmartContract) QueryTransferOfferbyToAccountID(ctx contractapi.TransactionContextInterface,
+	toAccountID string) ([]*TransferOffer, error) {
+
+	return getPendingTransferOfferQueryResultForIndex(ctx, transferOfferByToAccountIndex, toAccountID)
+}
+
+// QueryTransferOfferbyFromAccountID returns the unexpired offers made by the account
+func (s *SmartContract) QueryTransferOfferbyFromAccountID(ctx contractapi.TransactionContextInterface,
+	fromAccountID string) ([]*TransferOffer, error) {
+
+	return getPendingTransferOfferQueryResultForIndex(ctx, transferOfferByFromAccountIndex, fromAccountID)
+}
+
+// QueryTransferOfferbyToAccountIDWithPagination returns one page of the results of QueryTransferOfferbyToAccountID.
+func (s *SmartContract) QueryTransferOfferbyToAccountIDWithPagination(ctx contractapi.TransactionContextInterface,
+	toAccountID string, pageSize int32, bookmark string) (*PaginatedTransferOfferQueryResult, error) {
+
+	return getPendingTransferOfferQueryResultForIndexWithPagination(ctx, pageSize, bookmark, transferOfferByToAccountIndex, toAccountID)
+}
+
+// QueryTransferOfferbyFromAccountIDWithPagination returns one page of the results of QueryTransferOfferbyFromAccountID.
+func (s *SmartContract) QueryTransferOfferbyFromAccountIDWithPagination(ctx contractapi.TransactionContextInterface,
+	fromAccountID string, pageSize int32, bookmark string) (*PaginatedTransferOfferQueryResult, error) {
+
+	return getPendingTransferOfferQueryResultForIndexWithPagination(ctx, pageSize, bookmark, transferOfferByFromAccountIndex, fromAccountID)
+}
+
+// pendingTransferOffers leaves out the offers that expired at the transaction timestamp. Expired offers keep
+// their index entries until a party cancels them, so lookups filter them here.
+func pendingTransferOffers(ctx contractapi.TransactionContextInterface, offers []*TransferOffer) ([]*TransferOffer, error) {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := formatLedgerTime(txTime)
+
+	var pending []*TransferOffer
+	for _, offer := range offers {
+		if offer.ExpiresAt > now {
+			pending = append(pending, offer)
+		}
+	}
+
+	return pending, nil
+}
+
+func getPendingTransferOfferQueryResultForIndex(ctx contractapi.TransactionContextInterface, index string,
+	values ...string) ([]*TransferOffer, error) {
+
+	resultsIterator, err := getIndexedDocuments(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	offers, err := constructTransferOfferQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingTransferOffers(ctx, offers)
+}
+
+// getPendingTransferOfferQueryResultForIndexWithPagination returns one page of index entries with the expired
+// offers left out, so a page may hold fewer records than FetchedCount
+func getPendingTransferOfferQueryResultForIndexWithPagination(ctx contractapi.TransactionContextInterface, pageSize int32,
+	bookmark string, index string, values ...string) (*PaginatedTransferOfferQueryResult, error) {
+
+	resultsIterator, responseMetadata, err := getIndexedDocumentsWithPagination(ctx, pageSize, bookmark, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	offers, err := constructTransferOfferQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	offers, err = pendingTransferOffers(ctx, offers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedTransferOfferQueryResult{
+		Records:      offers,
+		FetchedCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:     responseMetadata.Bookmark,
+	}, nil
+}
+
+// readTransferOffer returns the pending transfer offer of the product
+func readTransferOffer(ctx contractapi.TransactionContextInterface, productKey string) (*TransferOffer, error) {
+	offerKey, err := transferOfferKey(ctx, productKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var offer TransferOffer
+	exists, err := readDocument(ctx, offerKey, &offer)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || offer.DocType != transferOfferObjectType {
+		return nil, ledgerErrorf(ErrNotFound, "there is no pending transfer offer for product %s", productKey)
+	}
+
+	return &offer, nil
+}
+
+// deleteTransferOffer removes the pending transfer offer of the product, if any
+func deleteTransferOffer(ctx contractapi.TransactionContextInterface, productKey string) error {
+	offerKey, err := transferOfferKey(ctx, productKey)
+	if err != nil {
+		return err
+	}
+
+	return deleteDocument(ctx, offerKey)
+}
+
+// requireDirectTransfer fails unless the submitter owns both the current and the new owner account of the
+// product. Handing a product to another identity needs its consent through OfferProductTransfer.
+func requireDirectTransfer(ctx contractapi.TransactionContextInterface, productKey string, product *Product, toAccountID string) error {
+	_, err := requireAccountOwner(ctx, product.ProductOwnerAccountID)
+	if err != nil {
+		return rephraseUnauthorized(err, "the submitting identity does not own product %s", productKey)
+	}
+
+	err = requireTransferable(ctx, productKey, product)
+	if err != nil {
+		return err
+	}
+
+	err = requireReference(ctx, "account", toAccountID)
+	if err != nil {
+		return err
+	}
+
+	_, err = requireAccountOwner(ctx, toAccountID)
+	if err != nil {
+		return rephraseUnauthorized(err, "the product %s can only be transferred to account %s with OfferProductTransfer", productKey, toAccountID)
+	}
+
+	return nil
+}
+
+// requireTransferable fails when the product may not change hands because it is recalled or expired
+func requireTransferable(ctx contractapi.TransactionContextInterface, productKey string, product *Product) error {
+	err := requireNotRecalled(productKey, product)
+	if err != nil {
+		return err
+	}
+
+	return requireNotExpired(ctx, productKey, product)
+}
+
+func constructTransferOfferQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*TransferOffer, error) {
+	var offers []*TransferOffer
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "failed to read query result: %v", err)
+		}
+		if len(offers) == maxUnpagedQueryResults {
+			return nil, ledgerErrorf(ErrTooManyResults, "the query matched more than %d transfer offers, use its paginated variant", maxUnpagedQueryResults)
+		}
+
+		var offer TransferOffer
+		err = json.Unmarshal(queryResult.Value, &offer)
+		if err != nil {
+			return nil, ledgerErrorf(ErrInternal, "the document %s is corrupt: %v", queryResult.Key, err)
+		}
+		offers = append(offers, &offer)
+	}
+
+	return offers, nil
+}
@@ -0,0 +1,198 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/ledgertest"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductTransferHandshake(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1": marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"account2": marshalDocument(t, &chaincode.Account{AccountMSPID: "Org2MSP", AccountClientID: "bob", DocType: "account"}),
+		"product1": marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", DocType: "product"}),
+	}
+	offerKey := "\x00transferOffer\x00product1\x00"
+	trackWrites := func(chaincodeStub *mocks.ChaincodeStub) {
+		chaincodeStub.PutStateStub = func(key string, value []byte) error {
+			worldState[key] = value
+			return nil
+		}
+		chaincodeStub.DelStateStub = func(key string) error {
+			delete(worldState, key)
+			return nil
+		}
+	}
+
+	alice, aliceStub := newGoodsLedgerContext(worldState, "Org1MSP", "alice")
+	trackWrites(aliceStub)
+	bob, bobStub := newGoodsLedgerContext(worldState, "Org2MSP", "bob")
+	trackWrites(bobStub)
+
+	goodsLedger := chaincode.SmartContract{}
+	err := goodsLedger.OfferProductTransfer(bob, "product1", "account2", "2020-09-14T00:00:00Z")
+	requireErrorCode(t, err, chaincode.ErrUnauthorized)
+
+	err = goodsLedger.OfferProductTransfer(alice, "product1", "account2", "2020-09-13T00:00:00Z")
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	// malformed inputs are all reported at once, before any state is read
+	err = goodsLedger.OfferProductTransfer(alice, "product1", strings.Repeat("a", 257), "tomorrow")
+	requireFieldErrors(t, err, "ToAccountID", "ExpiresAt")
+
+	err = goodsLedger.OfferProductTransfer(alice, "product1", "account2", "2020-09-14T00:00:00Z")
+	require.NoError(t, err)
+	offer, err := goodsLedger.ReadTransferOffer(alice, "product1")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.TransferOffer{
+		ProductKey:    "product1",
+		FromAccountID: "account1",
+		ToAccountID:   "account2",
+		OfferedAt:     "2020-09-13T12:26:40Z",
+		ExpiresAt:     "2020-09-14T00:00:00Z",
+		SchemaVersion: 1,
+		Version:       1,
+		DocType:       "transferOffer",
+	}, offer)
+
+	err = goodsLedger.AcceptProductTransfer(alice, "product1")
+	requireErrorCode(t, err, chaincode.ErrUnauthorized)
+
+	bobStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 1700000000}, nil)
+	err = goodsLedger.AcceptProductTransfer(bob, "product1")
+	requireErrorCode(t, err, chaincode.ErrExpired)
+
+	bobStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 1600000000}, nil)
+	err = goodsLedger.AcceptProductTransfer(bob, "product1")
+	require.NoError(t, err)
+	require.NotContains(t, worldState, offerKey)
+
+	var product chaincode.Product
+	require.NoError(t, json.Unmarshal(worldState["product1"], &product))
+	require.Equal(t, "account2", product.ProductOwnerAccountID)
+
+	err = goodsLedger.OfferProductTransfer(bob, "product1", "account1", "2020-09-14T00:00:00Z")
+	require.NoError(t, err)
+	err = goodsLedger.CancelProductTransfer(alice, "product1")
+	require.NoError(t, err)
+	require.NotContains(t, worldState, offerKey)
+
+	err = goodsLedger.CancelProductTransfer(alice, "product1")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	// a document of another DocType under the offer key is not an offer
+	worldState[offerKey] = marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account2", DocType: "product"})
+	_, err = goodsLedger.ReadTransferOffer(alice, "product1")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+}
+
+func TestOwnershipChecksKeepOtherErrors(t *testing.T) {
+	worldState := map[string][]byte{
+		"account1": marshalDocument(t, &chaincode.Account{AccountMSPID: "Org1MSP", AccountClientID: "alice", DocType: "account"}),
+		"account2": []byte("{not json"),
+		"product1": marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account1", DocType: "product"}),
+		"product2": marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "missing", DocType: "product"}),
+		"product3": marshalDocument(t, &chaincode.Product{ProductOwnerAccountID: "account2", DocType: "product"}),
+	}
+	bob, _ := newGoodsLedgerContext(worldState, "Org2MSP", "bob")
+
+	goodsLedger := chaincode.SmartContract{}
+	err := goodsLedger.SetProductReportedStolen(bob, "product1", true)
+	requireErrorCode(t, err, chaincode.ErrUnauthorized)
+
+	err = goodsLedger.SetProductReportedStolen(bob, "product2", true)
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	err = goodsLedger.SetProductReportedStolen(bob, "product3", true)
+	requireErrorCode(t, err, chaincode.ErrInternal)
+
+	err = goodsLedger.OfferProductTransfer(bob, "product2", "account1", "2020-09-14T00:00:00Z")
+	requireErrorCode(t, err, chaincode.ErrNotFound)
+
+	err = goodsLedger.UpdateProductOwner(bob, "product3", "account1", 0)
+	requireErrorCode(t, err, chaincode.ErrInternal)
+}
+
+func TestQueryTransferOfferbyToAccountID(t *testing.T) {
+	stub := ledgertest.NewStub()
+	alice := newScenarioContext(stub, "Org1MSP", "alice")
+	bob := newScenarioContext(stub, "Org2MSP", "bob")
+	goodsLedger := chaincode.SmartContract{}
+
+	aliceAccount := registerScenarioAccount(t, stub, alice, "tx-register-alice", "alice", "alice@example.com")
+	bobAccount := registerScenarioAccount(t, stub, bob, "tx-register-bob", "bob", "bob@example.com")
+
+	var manufacturerKey string
+	err := stub.Transact("tx-manufacturer", func() (err error) {
+		manufacturerKey, err = goodsLedger.AddManufacturer(alice, aliceAccount, "Acme", "licence1", "Dhaka", "2001-05-01", "manufacturer")
+		return err
+	})
+	require.NoError(t, err)
+
+	var factoryKey string
+	err = stub.Transact("tx-factory", func() (err error) {
+		factoryKey, err = goodsLedger.AddFactory(alice, manufacturerKey, "factory1", "Plant", "Dhaka", "factory")
+		return err
+	})
+	require.NoError(t, err)
+
+	var productKeys []string
+	for _, serial := range []string{"1", "2"} {
+		err = stub.Transact("tx-product-"+serial, func() error {
+			productKey, err := goodsLedger.AddProduct(alice, aliceAccount, manufacturerKey, "Acme", factoryKey, "sku", "Soap",
+				"cosmetics", "batch1", serial, "Dhaka", "2020-09-01", "", "product")
+			productKeys = append(productKeys, productKey)
+			return err
+		})
+		require.NoError(t, err)
+	}
+
+	for i, expiresAt := range []string{"2020-09-14T00:00:00Z", "2020-09-20T00:00:00Z"} {
+		err = stub.Transact(fmt.Sprintf("tx-offer-%d", i), func() error {
+			return goodsLedger.OfferProductTransfer(alice, productKeys[i], bobAccount, expiresAt)
+		})
+		require.NoError(t, err)
+	}
+
+	// the lookups go through composite key entries, which LevelDB peers support as well
+	var entries int
+	for _, key := range stub.Keys() {
+		objectType, _, err := stub.SplitCompositeKey(key)
+		if err == nil && (objectType == "transferOffer~to~key" || objectType == "transferOffer~from~key") {
+			entries++
+		}
+	}
+	require.Equal(t, 4, entries)
+
+	offers, err := goodsLedger.QueryTransferOfferbyToAccountID(bob, bobAccount)
+	require.NoError(t, err)
+	require.Len(t, offers, 2)
+
+	// once the first offer expires only the second one is pending
+	stub.TxTimestamp = time.Date(2020, 9, 15, 0, 0, 0, 0, time.UTC)
+	offers, err = goodsLedger.QueryTransferOfferbyToAccountID(bob, bobAccount)
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+	require.Equal(t, productKeys[1], offers[0].ProductKey)
+
+	offers, err = goodsLedger.QueryTransferOfferbyFromAccountID(alice, aliceAccount)
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+
+	page, err := goodsLedger.QueryTransferOfferbyToAccountIDWithPagination(bob, bobAccount, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, int32(2), page.FetchedCount)
+
+	offers, err = goodsLedger.QueryTransferOfferbyToAccountID(bob, aliceAccount)
+	require.NoError(t, err)
+	require.Empty(t, offers)
+}
@@ -0,0 +1,246 @@
+package chaincode
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Account types accepted in AccountType
+const (
+	AccountTypeCustomer     = "customer"
+	AccountTypeManufacturer = "manufacturer"
+	AccountTypeDistributor  = "distributor"
+	AccountTypeRetailer     = "retailer"
+)
+
+// Product types accepted in ProductType
+const (
+	ProductTypeCosmetics   = "cosmetics"
+	ProductTypeFood        = "food"
+	ProductTypeBeverage    = "beverage"
+	ProductTypeMedicine    = "medicine"
+	ProductTypeElectronics = "electronics"
+	ProductTypeClothing    = "clothing"
+	ProductTypeOther       = "other"
+)
+
+// Length limits of validated fields, in characters
+const (
+	maxIDLength       = 64
+	maxKeyLength      = 256
+	maxNameLength     = 128
+	maxLocationLength = 256
+	maxEmailLength    = 254
+	maxPhoneLength    = 32
+	minTokenLength    = 32
+	maxTokenLength    = 4096
+	maxReasonLength   = 1024
+)
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s.]+$`)
+	phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{5,}[0-9]$`)
+)
+
+// FieldError describes why the value of one input field was rejected
+type FieldError struct {
+	Field   string `json:"Field"`
+	Message string `json:"Message"`
+}
+
+// fieldRule checks a field value and describes what is wrong with it, or returns "" when it is valid.
+// Every rule but required accepts the empty value, so a field without required is optional.
+type fieldRule func(value string) string
+
+// fieldValidation lists the rules of one field
+type fieldValidation struct {
+	field string
+	rules []fieldRule
+}
+
+// fieldValidations are the rules of an entity, in the order field errors are reported. They apply to any
+// struct with fields of these names, so one set covers an entity's input and the details its owner may update.
+type fieldValidations []fieldValidation
+
+var accountValidations = fieldValidations{
+	{"AccountType", []fieldRule{required, oneOf(AccountTypeCustomer, AccountTypeManufacturer, AccountTypeDistributor, AccountTypeRetailer)}},
+	{"AccountUsername", []fieldRule{required, maxLength(maxIDLength)}},
+	{"AccountOwnerManufacturerID", []fieldRule{maxLength(maxKeyLength)}},
+}
+
+var accountDetailsValidations = fieldValidations{
+	{"AccountName", []fieldRule{required, maxLength(maxNameLength)}},
+	{"AccountEmail", []fieldRule{required, maxLength(maxEmailLength), matching(emailPattern, "an email address")}},
+	{"AccountPhoneNumber", []fieldRule{maxLength(maxPhoneLength), matching(phonePattern, "a phone number")}},
+}
+
+var accountSecretValidations = fieldValidations{
+	{"AccountPassword", []fieldRule{required}},
+	{"AccountToken", []fieldRule{minLength(minTokenLength), maxLength(maxTokenLength)}},
+}
+
+var manufacturerValidations = fieldValidations{
+	{"ManufacturerAccountID", []fieldRule{required, maxLength(maxKeyLength)}},
+	{"ManufacturerName", []fieldRule{required, maxLength(maxNameLength)}},
+	{"ManufacturerTradeLicenceID", []fieldRule{required, maxLength(maxIDLength)}},
+	{"ManufacturerLocation", []fieldRule{maxLength(maxLocationLength)}},
+	{"ManufacturerFoundingDate", []fieldRule{required, ledgerDate}},
+}
+
+var factoryValidations = fieldValidations{
+	{"FactoryManufacturerID", []fieldRule{required, maxLength(maxKeyLength)}},
+	{"FactoryID", []fieldRule{required, maxLength(maxIDLength)}},
+	{"FactoryName", []fieldRule{required, maxLength(maxNameLength)}},
+	{"FactoryLocation", []fieldRule{maxLength(maxLocationLength)}},
+}
+
+var productValidations = fieldValidations{
+	{"ProductOwnerAccountID", []fieldRule{required, maxLength(maxKeyLength)}},
+	{"ProductManufacturerID", []fieldRule{required, maxLength(maxKeyLength)}},
+	{"ProductManufacturerName", []fieldRule{maxLength(maxNameLength)}},
+	{"ProductFactoryID", []fieldRule{required, maxLength(maxKeyLength)}},
+	{"ProductID", []fieldRule{required, maxLength(maxIDLength)}},
+	{"ProductName", []fieldRule{required, maxLength(maxNameLength)}},
+	{"ProductType", []fieldRule{required, oneOf(ProductTypeCosmetics, ProductTypeFood, ProductTypeBeverage, ProductTypeMedicine,
+		ProductTypeElectronics, ProductTypeClothing, ProductTypeOther)}},
+	{"ProductBatch", []fieldRule{required, maxLength(maxIDLength)}},
+	{"ProductSerialinBatch", []fieldRule{required, maxLength(maxIDLength)}},
+	{"ProductManufacturingLocation", []fieldRule{maxLength(maxLocationLength)}},
+	{"ProductManufacturingDate", []fieldRule{required, ledgerDate}},
+	{"ProductExpiryDate", []fieldRule{ledgerDate}},
+}
+
+var batchValidations = fieldValidations{
+	{"BatchID", []fieldRule{required, maxLength(maxIDLength)}},
+	{"BatchProductionStart", []fieldRule{required, ledgerDate}},
+	{"BatchProductionEnd", []fieldRule{required, ledgerDate}},
+	{"BatchExpiryDate", []fieldRule{ledgerDate}},
+}
+
+var transferOfferValidations = fieldValidations{
+	{"ProductKey", []fieldRule{required}},
+	{"ToAccountID", []fieldRule{required, maxLength(maxKeyLength)}},
+	{"ExpiresAt", []fieldRule{required, ledgerDate}},
+}
+
+var recallValidations = fieldValidations{
+	{"RecallReason", []fieldRule{required, maxLength(maxReasonLength)}},
+}
+
+// only returns the validations of the given fields
+func (validations fieldValidations) only(fields ...string) fieldValidations {
+	var selected fieldValidations
+	for _, validation := range validations {
+		if containsString(fields, validation.field) {
+			selected = append(selected, validation)
+		}
+	}
+
+	return selected
+}
+
+// check applies the validations to the string fields of a struct, skipping fields the struct does not have
+func (validations fieldValidations) check(input interface{}) []FieldError {
+	value := reflect.Indirect(reflect.ValueOf(input))
+
+	var fieldErrors []FieldError
+	for _, validation := range validations {
+		field := value.FieldByName(validation.field)
+		if !field.IsValid() || field.Kind() != reflect.String {
+			continue
+		}
+
+		for _, rule := range validation.rules {
+			problem := rule(field.String())
+			if problem != "" {
+				fieldErrors = append(fieldErrors, FieldError{Field: validation.field, Message: validation.field + " " + problem})
+				break
+			}
+		}
+	}
+
+	return fieldErrors
+}
+
+// validationError reports every field error at once, or returns nil when there are none
+func validationError(fieldErrors ...[]FieldError) error {
+	var all []FieldError
+	var messages []string
+	for _, group := range fieldErrors {
+		for _, fieldError := range group {
+			all = append(all, fieldError)
+			messages = append(messages, fieldError.Message)
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	return &LedgerError{
+		Code:        ErrValidationFailed,
+		Message:     fmt.Sprintf("the input is invalid: %s", strings.Join(messages, "; ")),
+		FieldErrors: all,
+	}
+}
+
+func required(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "is required"
+	}
+
+	return ""
+}
+
+func maxLength(limit int) fieldRule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) > limit {
+			return fmt.Sprintf("must be at most %d characters long", limit)
+		}
+
+		return ""
+	}
+}
+
+func minLength(limit int) fieldRule {
+	return func(value string) string {
+		if value != "" && utf8.RuneCountInString(value) < limit {
+			return fmt.Sprintf("must be at least %d characters long", limit)
+		}
+
+		return ""
+	}
+}
+
+func oneOf(allowed ...string) fieldRule {
+	return func(value string) string {
+		if value != "" && !containsString(allowed, value) {
+			return fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))
+		}
+
+		return ""
+	}
+}
+
+func matching(pattern *regexp.Regexp, description string) fieldRule {
+	return func(value string) string {
+		if value != "" && !pattern.MatchString(value) {
+			return "is not " + description
+		}
+
+		return ""
+	}
+}
+
+func ledgerDate(value string) string {
+	if value == "" {
+		return ""
+	}
+	if _, err := parseLedgerDate(value); err != nil {
+		return "is not in RFC 3339 format"
+	}
+
+	return ""
+}
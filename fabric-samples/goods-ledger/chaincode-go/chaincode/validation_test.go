@@ -0,0 +1,72 @@
+package chaincode_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+// requireFieldErrors asserts that err is a validation failure of exactly the given fields
+func requireFieldErrors(t *testing.T, err error, fields ...string) {
+	requireErrorCode(t, err, chaincode.ErrValidationFailed)
+
+	var ledgerError *chaincode.LedgerError
+	require.True(t, errors.As(err, &ledgerError))
+
+	var rejected []string
+	for _, fieldError := range ledgerError.FieldErrors {
+		rejected = append(rejected, fieldError.Field)
+	}
+	require.Equal(t, fields, rejected, ledgerError.Message)
+}
+
+func TestCreateValidation(t *testing.T) {
+	transactionContext, chaincodeStub := newGoodsLedgerContext(map[string][]byte{}, "Org1MSP", "alice")
+	goodsLedger := chaincode.SmartContract{}
+
+	_, err := goodsLedger.CreateProduct(transactionContext, chaincode.ProductInput{
+		ProductManufacturerID: "manufacturer1",
+		ProductDetails: chaincode.ProductDetails{
+			ProductOwnerAccountID:    "account1",
+			ProductFactoryID:         "factory1",
+			ProductName:              "  ",
+			ProductType:              "weapons",
+			ProductBatch:             "batch1",
+			ProductSerialinBatch:     "1",
+			ProductManufacturingDate: "2020-09-01",
+			ProductExpiryDate:        "next year",
+		},
+	})
+	requireFieldErrors(t, err, "ProductID", "ProductName", "ProductType", "ProductExpiryDate")
+
+	_, err = goodsLedger.CreateFactory(transactionContext, chaincode.FactoryInput{
+		FactoryID: "factory1",
+		FactoryDetails: chaincode.FactoryDetails{
+			FactoryManufacturerID: "manufacturer1",
+			FactoryName:           string(make([]byte, 129)),
+		},
+	})
+	requireFieldErrors(t, err, "FactoryName")
+
+	err = goodsLedger.UpdateManufacturerDetails(transactionContext, "manufacturer1", chaincode.ManufacturerDetails{ManufacturerFoundingDate: "2001-01-01"}, 1)
+	requireFieldErrors(t, err, "ManufacturerName", "ManufacturerTradeLicenceID")
+
+	_, err = goodsLedger.MintBatch(transactionContext, "manufacturer1", "factory1", "", "sku", "Soap", "toys", "", "2020-08-01", "2020-09-01", "", 10)
+	requireFieldErrors(t, err, "BatchID", "ProductType")
+
+	chaincodeStub.GetTransientReturns(map[string][]byte{
+		"account_secret":  marshalDocument(t, &chaincode.AccountSecretInput{AccountPassword: "$2a$10$hash"}),
+		"account_details": marshalDocument(t, &chaincode.AccountDetails{AccountName: "Alice", AccountEmail: "alice@example", AccountPhoneNumber: "call me"}),
+	}, nil)
+	_, err = goodsLedger.CreateAccount(transactionContext, chaincode.AccountInput{AccountType: "admin", AccountUsername: "alice"})
+	requireFieldErrors(t, err, "AccountType", "AccountEmail", "AccountPhoneNumber")
+
+	chaincodeStub.GetTransientReturns(map[string][]byte{
+		"account_secret":  marshalDocument(t, &chaincode.AccountSecretInput{AccountPassword: "$2a$10$hash"}),
+		"account_details": marshalDocument(t, &chaincode.AccountDetails{AccountName: "Alice", AccountEmail: "alice@example.com", AccountPhoneNumber: "+880 1711-000000"}),
+	}, nil)
+	_, err = goodsLedger.CreateAccount(transactionContext, chaincode.AccountInput{AccountType: chaincode.AccountTypeRetailer, AccountUsername: "alice"})
+	require.NoError(t, err)
+}
@@ -0,0 +1,101 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ProductVerdict is the authenticity verdict returned for a scanned product code
+type ProductVerdict struct {
+	ProductCode                string   `json:"ProductCode"`
+	Genuine                    bool     `json:"Genuine"`
+	ProductExists              bool     `json:"ProductExists"`
+	ManufacturerExists         bool     `json:"ManufacturerExists"`
+	ManufacturerName           string   `json:"ManufacturerName"`
+	FactoryExists              bool     `json:"FactoryExists"`
+	FactoryMatchesManufacturer bool     `json:"FactoryMatchesManufacturer"`
+	Expired                    bool     `json:"Expired"`
+	ReportedStolen             bool     `json:"ReportedStolen"`
+	Recalled                   bool     `json:"Recalled"`
+	CurrentOwnerAccountID      string   `json:"CurrentOwnerAccountID"`
+	Product                    *Product `json:"Product,omitempty" metadata:",optional"`
+	Problems                   []string `json:"Problems"`
+}
+
+// VerifyProduct checks a scanned product code against the ledger and returns a single authenticity verdict.
+// A product is genuine when it exists, its manufacturer and factory exist and agree with each other,
+// and it is neither expired, reported stolen nor recalled. Manufacturers are matched by key, so a renamed
+// manufacturer's products stay genuine; the verdict carries the manufacturer's current name.
+func (s *SmartContract) VerifyProduct(ctx contractapi.TransactionContextInterface, productCode string) (*ProductVerdict, error) {
+	verdict := &ProductVerdict{ProductCode: productCode, Problems: []string{}}
+
+	var product Product
+	exists, err := readDocument(ctx, productCode, &product)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || product.DocType != productObjectType {
+		verdict.Problems = append(verdict.Problems, "product is not registered on the ledger")
+		return verdict, nil
+	}
+	verdict.ProductExists = true
+	verdict.Product = &product
+	verdict.CurrentOwnerAccountID = product.ProductOwnerAccountID
+
+	var manufacturer Manufacturer
+	verdict.ManufacturerExists, err = readDocument(ctx, product.ProductManufacturerID, &manufacturer)
+	if err != nil {
+		return nil, err
+	}
+	// a key holding another type of document does not make the manufacturer registered
+	verdict.ManufacturerExists = verdict.ManufacturerExists && manufacturer.DocType == manufacturerObjectType
+	if verdict.ManufacturerExists {
+		verdict.ManufacturerName = manufacturer.ManufacturerName
+	} else {
+		verdict.Problems = append(verdict.Problems, "product manufacturer is not registered on the ledger")
+	}
+
+	var factory Factory
+	verdict.FactoryExists, err = readDocument(ctx, product.ProductFactoryID, &factory)
+	if err != nil {
+		return nil, err
+	}
+	// a key holding another type of document does not make the factory registered
+	verdict.FactoryExists = verdict.FactoryExists && factory.DocType == factoryObjectType
+	if verdict.FactoryExists {
+		verdict.FactoryMatchesManufacturer = factory.FactoryManufacturerID == product.ProductManufacturerID
+		if !verdict.FactoryMatchesManufacturer {
+			verdict.Problems = append(verdict.Problems, "product factory belongs to a different manufacturer")
+		}
+	} else {
+		verdict.Problems = append(verdict.Problems, "product factory is not registered on the ledger")
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.ProductExpiryDate != "" {
+		expiryDate, err := parseExpiryDate(product.ProductExpiryDate)
+		if err != nil {
+			verdict.Problems = append(verdict.Problems, "product expiry date cannot be read")
+		} else if isExpiredAt(expiryDate, now) {
+			verdict.Expired = true
+			verdict.Problems = append(verdict.Problems, "product is expired")
+		}
+	}
+
+	verdict.ReportedStolen = product.ProductReportedStolen
+	if verdict.ReportedStolen {
+		verdict.Problems = append(verdict.Problems, "product is reported stolen")
+	}
+
+	verdict.Recalled = product.ProductRecallStatus == productRecalled
+	if verdict.Recalled {
+		verdict.Problems = append(verdict.Problems, "product is under recall: "+product.ProductRecallReason)
+	}
+
+	verdict.Genuine = len(verdict.Problems) == 0
+
+	return verdict, nil
+}
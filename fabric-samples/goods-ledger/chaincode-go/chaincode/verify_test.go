@@ -0,0 +1,62 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyProduct(t *testing.T) {
+	product := &chaincode.Product{
+		ProductOwnerAccountID:   "account1",
+		ProductManufacturerID:   "manufacturer1",
+		ProductManufacturerName: "Acme",
+		ProductFactoryID:        "factory1",
+		ProductExpiryDate:       "2030-01-01",
+		DocType:                 "product",
+	}
+	worldState := map[string][]byte{
+		"manufacturer1": marshalDocument(t, &chaincode.Manufacturer{ManufacturerName: "Acme", DocType: "manufacturer"}),
+		"factory1":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer1", DocType: "factory"}),
+		"factory2":      marshalDocument(t, &chaincode.Factory{FactoryManufacturerID: "manufacturer2", DocType: "factory"}),
+		"product1":      marshalDocument(t, product),
+	}
+
+	transactionContext, chaincodeStub := newGoodsLedgerContext(worldState, "Org2MSP", "consumer")
+	chaincodeStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 1600000000}, nil)
+
+	goodsLedger := chaincode.SmartContract{}
+	verdict, err := goodsLedger.VerifyProduct(transactionContext, "product1")
+	require.NoError(t, err)
+	require.True(t, verdict.Genuine)
+	require.Empty(t, verdict.Problems)
+	require.Equal(t, "account1", verdict.CurrentOwnerAccountID)
+
+	verdict, err = goodsLedger.VerifyProduct(transactionContext, "counterfeit")
+	require.NoError(t, err)
+	require.False(t, verdict.Genuine)
+	require.False(t, verdict.ProductExists)
+
+	// renaming the manufacturer keeps its products genuine
+	worldState["manufacturer1"] = marshalDocument(t, &chaincode.Manufacturer{ManufacturerName: "Acme Inc", DocType: "manufacturer"})
+	verdict, err = goodsLedger.VerifyProduct(transactionContext, "product1")
+	require.NoError(t, err)
+	require.True(t, verdict.Genuine)
+	require.Equal(t, "Acme Inc", verdict.ManufacturerName)
+
+	product.ProductFactoryID = "factory2"
+	product.ProductReportedStolen = true
+	worldState["product1"] = marshalDocument(t, product)
+	chaincodeStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 1900000000}, nil)
+
+	verdict, err = goodsLedger.VerifyProduct(transactionContext, "product1")
+	require.NoError(t, err)
+	require.False(t, verdict.Genuine)
+	require.True(t, verdict.ManufacturerExists)
+	require.False(t, verdict.FactoryMatchesManufacturer)
+	require.True(t, verdict.Expired)
+	require.True(t, verdict.ReportedStolen)
+	require.Len(t, verdict.Problems, 3)
+}
@@ -5,19 +5,100 @@ SPDX-License-Identifier: Apache-2.0
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
 
-	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
 )
 
+// serverConfig configures the chaincode to run as an external chaincode server (chaincode as a service)
+// instead of being launched by the peer
+type serverConfig struct {
+	CCID    string
+	Address string
+	// TLS is enabled when both TLSKeyFile and TLSCertFile are set
+	TLSKeyFile  string
+	TLSCertFile string
+	// the peer's client certificate is only verified when ClientCAFile is set
+	ClientCAFile string
+}
+
 func main() {
-	assetChaincode, err := contractapi.NewChaincode(&chaincode.SmartContract{})
+	assetChaincode, err := chaincode.NewChaincode()
 	if err != nil {
 		log.Panicf("Error creating asset-transfer-basic chaincode: %v", err)
 	}
 
-	if err := assetChaincode.Start(); err != nil {
-		log.Panicf("Error starting asset-transfer-basic chaincode: %v", err)
+	config, ok := serverConfigFromEnv()
+	if !ok {
+		if err := shim.Start(assetChaincode); err != nil {
+			log.Panicf("Error starting asset-transfer-basic chaincode: %v", err)
+		}
+		return
+	}
+
+	tlsProperties, err := config.tlsProperties()
+	if err != nil {
+		log.Panicf("Error reading asset-transfer-basic chaincode server TLS files: %v", err)
+	}
+
+	server := &shim.ChaincodeServer{
+		CCID:     config.CCID,
+		Address:  config.Address,
+		CC:       assetChaincode,
+		TLSProps: tlsProperties,
 	}
+	if err := server.Start(); err != nil {
+		log.Panicf("Error starting asset-transfer-basic chaincode server: %v", err)
+	}
+}
+
+// serverConfigFromEnv reads the chaincode server configuration; ok is false unless both
+// CHAINCODE_SERVER_ADDRESS and CHAINCODE_ID are set, in which case the peer launches the chaincode
+func serverConfigFromEnv() (config serverConfig, ok bool) {
+	config = serverConfig{
+		CCID:         os.Getenv("CHAINCODE_ID"),
+		Address:      os.Getenv("CHAINCODE_SERVER_ADDRESS"),
+		TLSKeyFile:   os.Getenv("CHAINCODE_TLS_KEY_FILE"),
+		TLSCertFile:  os.Getenv("CHAINCODE_TLS_CERT_FILE"),
+		ClientCAFile: os.Getenv("CHAINCODE_CLIENT_CA_CERT_FILE"),
+	}
+
+	return config, config.CCID != "" && config.Address != ""
+}
+
+// tlsProperties loads the TLS files of the configuration
+func (config serverConfig) tlsProperties() (shim.TLSProperties, error) {
+	if config.TLSKeyFile == "" && config.TLSCertFile == "" {
+		if config.ClientCAFile != "" {
+			return shim.TLSProperties{}, fmt.Errorf("CHAINCODE_CLIENT_CA_CERT_FILE requires CHAINCODE_TLS_KEY_FILE and CHAINCODE_TLS_CERT_FILE")
+		}
+		return shim.TLSProperties{Disabled: true}, nil
+	}
+	if config.TLSKeyFile == "" || config.TLSCertFile == "" {
+		return shim.TLSProperties{}, fmt.Errorf("CHAINCODE_TLS_KEY_FILE and CHAINCODE_TLS_CERT_FILE must be set together")
+	}
+
+	key, err := ioutil.ReadFile(config.TLSKeyFile)
+	if err != nil {
+		return shim.TLSProperties{}, err
+	}
+
+	cert, err := ioutil.ReadFile(config.TLSCertFile)
+	if err != nil {
+		return shim.TLSProperties{}, err
+	}
+
+	var clientCACerts []byte
+	if config.ClientCAFile != "" {
+		clientCACerts, err = ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return shim.TLSProperties{}, err
+		}
+	}
+
+	return shim.TLSProperties{Key: key, Cert: cert, ClientCACerts: clientCACerts}, nil
 }
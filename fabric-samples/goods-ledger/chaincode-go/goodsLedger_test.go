@@ -0,0 +1,129 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerConfigFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goodsLedger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+	keyFile := writeFile("server.key", "key")
+	certFile := writeFile("server.crt", "cert")
+	clientCAFile := writeFile("ca.crt", "client ca")
+
+	tests := []struct {
+		name          string
+		env           map[string]string
+		ok            bool
+		tlsProperties shim.TLSProperties
+		tlsError      string
+	}{
+		{
+			name: "launched by the peer",
+			env:  map[string]string{"CHAINCODE_ID": "goods:1"},
+			ok:   false,
+		},
+		{
+			name:          "TLS disabled",
+			env:           map[string]string{"CHAINCODE_ID": "goods:1", "CHAINCODE_SERVER_ADDRESS": "0.0.0.0:9999"},
+			ok:            true,
+			tlsProperties: shim.TLSProperties{Disabled: true},
+		},
+		{
+			name: "key and certificate set",
+			env: map[string]string{"CHAINCODE_ID": "goods:1", "CHAINCODE_SERVER_ADDRESS": "0.0.0.0:9999",
+				"CHAINCODE_TLS_KEY_FILE": keyFile, "CHAINCODE_TLS_CERT_FILE": certFile},
+			ok:            true,
+			tlsProperties: shim.TLSProperties{Key: []byte("key"), Cert: []byte("cert")},
+		},
+		{
+			name: "only the key set",
+			env: map[string]string{"CHAINCODE_ID": "goods:1", "CHAINCODE_SERVER_ADDRESS": "0.0.0.0:9999",
+				"CHAINCODE_TLS_KEY_FILE": keyFile},
+			ok:       true,
+			tlsError: "CHAINCODE_TLS_KEY_FILE and CHAINCODE_TLS_CERT_FILE must be set together",
+		},
+		{
+			name: "only the certificate set",
+			env: map[string]string{"CHAINCODE_ID": "goods:1", "CHAINCODE_SERVER_ADDRESS": "0.0.0.0:9999",
+				"CHAINCODE_TLS_CERT_FILE": certFile},
+			ok:       true,
+			tlsError: "CHAINCODE_TLS_KEY_FILE and CHAINCODE_TLS_CERT_FILE must be set together",
+		},
+		{
+			name: "client CA file set",
+			env: map[string]string{"CHAINCODE_ID": "goods:1", "CHAINCODE_SERVER_ADDRESS": "0.0.0.0:9999",
+				"CHAINCODE_TLS_KEY_FILE": keyFile, "CHAINCODE_TLS_CERT_FILE": certFile, "CHAINCODE_CLIENT_CA_CERT_FILE": clientCAFile},
+			ok:            true,
+			tlsProperties: shim.TLSProperties{Key: []byte("key"), Cert: []byte("cert"), ClientCACerts: []byte("client ca")},
+		},
+		{
+			name: "client CA file set without TLS",
+			env: map[string]string{"CHAINCODE_ID": "goods:1", "CHAINCODE_SERVER_ADDRESS": "0.0.0.0:9999",
+				"CHAINCODE_CLIENT_CA_CERT_FILE": clientCAFile},
+			ok:       true,
+			tlsError: "CHAINCODE_CLIENT_CA_CERT_FILE requires CHAINCODE_TLS_KEY_FILE and CHAINCODE_TLS_CERT_FILE",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setServerEnv(t, test.env)
+
+			config, ok := serverConfigFromEnv()
+			require.Equal(t, test.ok, ok)
+			if !ok {
+				return
+			}
+			require.Equal(t, "goods:1", config.CCID)
+			require.Equal(t, "0.0.0.0:9999", config.Address)
+
+			tlsProperties, err := config.tlsProperties()
+			if test.tlsError != "" {
+				require.EqualError(t, err, test.tlsError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.tlsProperties, tlsProperties)
+		})
+	}
+}
+
+// setServerEnv sets the chaincode server variables to env, clearing the others, and restores them after the test
+func setServerEnv(t *testing.T, env map[string]string) {
+	for _, name := range []string{"CHAINCODE_ID", "CHAINCODE_SERVER_ADDRESS", "CHAINCODE_TLS_KEY_FILE",
+		"CHAINCODE_TLS_CERT_FILE", "CHAINCODE_CLIENT_CA_CERT_FILE"} {
+		previous, set := os.LookupEnv(name)
+		if value, ok := env[name]; ok {
+			require.NoError(t, os.Setenv(name, value))
+		} else {
+			require.NoError(t, os.Unsetenv(name))
+		}
+
+		name := name
+		t.Cleanup(func() {
+			if set {
+				os.Setenv(name, previous)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}